@@ -4,21 +4,42 @@ import (
 	"context"
 	"expvar"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 
+	apiKeysHandler "greenlight/internal/apikeys/handlers"
+	apiKeysRepo "greenlight/internal/apikeys/repo"
+	genresHandler "greenlight/internal/genres/handlers"
+	genresRepo "greenlight/internal/genres/repo"
 	healthcheckHandler "greenlight/internal/healthcheck/handlers"
 	moviesHandler "greenlight/internal/movies/handlers"
 	moviesRepo "greenlight/internal/movies/repo"
+	peopleHandler "greenlight/internal/people/handlers"
+	peopleRepo "greenlight/internal/people/repo"
+	permissionsHandler "greenlight/internal/permissions/handlers"
 	permissionsRepo "greenlight/internal/permissions/repo"
+	reviewsHandler "greenlight/internal/reviews/handlers"
+	reviewsRepo "greenlight/internal/reviews/repo"
 	userHandlers "greenlight/internal/users/handlers"
+	userModels "greenlight/internal/users/models"
 	userRepos "greenlight/internal/users/repo"
+	userServices "greenlight/internal/users/services"
+	watchlistsHandler "greenlight/internal/watchlists/handlers"
+	watchlistsRepo "greenlight/internal/watchlists/repo"
 	"greenlight/pkg/jsonlog"
 	"greenlight/pkg/mailer"
+	"greenlight/pkg/oidc"
+	"greenlight/pkg/passwordhash"
+	"greenlight/pkg/passwordpolicy"
+	"greenlight/pkg/signedtoken"
+	"greenlight/pkg/throttle"
 )
 
 const version = "1.0.0"
@@ -38,6 +59,47 @@ type config struct {
 		burst   int
 		enabled bool
 	}
+	tokens struct {
+		accessTTL   time.Duration
+		refreshTTL  time.Duration
+		mode        string
+		signingKeys string
+	}
+	activation struct {
+		resendLimit  int
+		resendWindow time.Duration
+	}
+	cookies struct {
+		secure bool
+	}
+	magicLink struct {
+		url    string
+		limit  int
+		window time.Duration
+	}
+	oidc struct {
+		issuer             string
+		clientID           string
+		clientSecret       string
+		redirectURL        string
+		defaultPermissions string
+	}
+	passwords struct {
+		memory      uint
+		iterations  uint
+		parallelism uint
+		minEntropy  float64
+		breached    string
+	}
+	roles struct {
+		defaultRole string
+	}
+	login struct {
+		backoffAfter int
+		lockAfter    int
+		lockDuration time.Duration
+		window       time.Duration
+	}
 	smtp struct {
 		host     string
 		port     int
@@ -62,6 +124,40 @@ func main() {
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
 
+	flag.DurationVar(&cfg.tokens.accessTTL, "access-token-ttl", 15*time.Minute, "Authentication token lifetime")
+	flag.DurationVar(&cfg.tokens.refreshTTL, "refresh-token-ttl", 30*24*time.Hour, "Refresh token lifetime")
+	flag.StringVar(&cfg.tokens.mode, "token-mode", "opaque", "Authentication token mode (opaque|signed)")
+	flag.StringVar(&cfg.tokens.signingKeys, "token-signing-keys", os.Getenv("GREENLIGHT_TOKEN_SIGNING_KEYS"), "Comma separated id:algorithm:base64-secret signing keys (HS256|EdDSA), the first one signs new tokens")
+
+	flag.BoolVar(&cfg.cookies.secure, "cookie-secure", true, "Mark session cookies Secure, disable to use browser sessions over plain HTTP in development")
+
+	flag.StringVar(&cfg.roles.defaultRole, "default-role", "viewer", "Role given to new users")
+
+	flag.IntVar(&cfg.activation.resendLimit, "activation-resend-limit", 3, "Maximum activation emails resent per address within the resend window")
+	flag.DurationVar(&cfg.activation.resendWindow, "activation-resend-window", time.Hour, "Activation email resend window")
+
+	flag.UintVar(&cfg.passwords.memory, "password-argon2-memory", uint(passwordhash.DefaultArgon2idParams.Memory), "Argon2id password hashing memory in KiB")
+	flag.UintVar(&cfg.passwords.iterations, "password-argon2-iterations", uint(passwordhash.DefaultArgon2idParams.Iterations), "Argon2id password hashing iterations")
+	flag.UintVar(&cfg.passwords.parallelism, "password-argon2-parallelism", uint(passwordhash.DefaultArgon2idParams.Parallelism), "Argon2id password hashing parallelism")
+
+	flag.StringVar(&cfg.magicLink.url, "magic-link-url", "", "Page login links are sent to, with the token as the token query parameter")
+	flag.IntVar(&cfg.magicLink.limit, "magic-link-limit", 3, "Maximum login links sent per address within the magic link window")
+	flag.DurationVar(&cfg.magicLink.window, "magic-link-window", time.Hour, "Login link rate limit window")
+
+	flag.StringVar(&cfg.oidc.issuer, "oidc-issuer", "", "OpenID Connect provider issuer URL, leave empty to disable identity provider logins")
+	flag.StringVar(&cfg.oidc.clientID, "oidc-client-id", "", "OpenID Connect client ID")
+	flag.StringVar(&cfg.oidc.clientSecret, "oidc-client-secret", os.Getenv("GREENLIGHT_OIDC_CLIENT_SECRET"), "OpenID Connect client secret")
+	flag.StringVar(&cfg.oidc.redirectURL, "oidc-redirect-url", "", "Page the identity provider sends users back to with the authorization code")
+	flag.StringVar(&cfg.oidc.defaultPermissions, "oidc-default-permissions", "", "Comma separated permissions granted, on top of -default-role, to users created on their first identity provider login")
+
+	flag.Float64Var(&cfg.passwords.minEntropy, "password-min-entropy", 40, "Minimum estimated entropy of new passwords in bits")
+	flag.StringVar(&cfg.passwords.breached, "password-breached-file", os.Getenv("GREENLIGHT_BREACHED_PASSWORDS_FILE"), "Have I Been Pwned file of breached password SHA-1 hashes sorted by hash, or directory of its range files, new passwords found in it are rejected")
+
+	flag.IntVar(&cfg.login.backoffAfter, "login-backoff-after", 3, "Failed logins of an account before every attempt has to wait exponentially longer")
+	flag.IntVar(&cfg.login.lockAfter, "login-lock-after", 10, "Failed logins of an account before it is locked, IPs get ten times as many")
+	flag.DurationVar(&cfg.login.lockDuration, "login-lock-duration", 15*time.Minute, "Login lockout duration")
+	flag.DurationVar(&cfg.login.window, "login-window", time.Hour, "Time after which failed logins are forgotten")
+
 	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
 	flag.StringVar(&cfg.smtp.username, "smtp-username", "470a33d889c91a", "SMTP username")
@@ -72,6 +168,25 @@ func main() {
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	// Hashes made with weaker parameters than these are upgraded when their owners log in.
+	userModels.PasswordHasher = passwordhash.New(
+		passwordhash.NewArgon2id(passwordhash.Argon2idParams{
+			Memory:      uint32(cfg.passwords.memory),
+			Iterations:  uint32(cfg.passwords.iterations),
+			Parallelism: uint8(cfg.passwords.parallelism),
+			SaltLength:  passwordhash.DefaultArgon2idParams.SaltLength,
+			KeyLength:   passwordhash.DefaultArgon2idParams.KeyLength,
+		}),
+		passwordhash.NewBcrypt(12),
+	)
+
+	passwordPolicy, err := newPasswordPolicy(cfg, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	userModels.PasswordPolicy = passwordPolicy
+
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -84,31 +199,144 @@ func main() {
 		Env:     cfg.env,
 	}
 
+	var authority *signedtoken.Authority
+	if cfg.tokens.mode == "signed" {
+		authority, err = openTokenAuthority(cfg, db, logger)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	userRepo := userRepos.NewUserSqlxRepo(db)
+	tokenRepo := userRepos.NewTokenSqlxRepo(db)
+	roleRepo := permissionsRepo.NewRoleSqlxRepo(db)
+	apiKeysRepo := apiKeysRepo.NewSqlxRepo(db)
+	permissionsRepo := permissionsRepo.NewSqlxRepo(db)
+
+	err = checkDefaultGrants(cfg, roleRepo, permissionsRepo)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	mailer := mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
+
+	moviesRepo := moviesRepo.NewSqlxRepo(db)
+	peopleRepo := peopleRepo.NewSqlxRepo(db)
+	genresRepo := genresRepo.NewSqlxRepo(db)
+
 	moviesHandler := &moviesHandler.Handler{
-		Logger: logger,
-		Repo:   moviesRepo.NewSqlxRepo(db),
+		Logger:          logger,
+		Repo:            moviesRepo,
+		CreditRepo:      peopleRepo,
+		GenreRepo:       genresRepo,
+		PermissionsRepo: permissionsRepo,
+	}
+
+	peopleHandler := &peopleHandler.Handler{
+		Repo: peopleRepo,
+	}
+
+	genresHandler := &genresHandler.Handler{
+		Repo: genresRepo,
+	}
+
+	reviewsHandler := &reviewsHandler.Handler{
+		Repo:      reviewsRepo.NewSqlxRepo(db),
+		MovieRepo: moviesRepo,
 	}
 
+	watchlistsHandler := &watchlistsHandler.Handler{
+		Repo:      watchlistsRepo.NewSqlxRepo(db),
+		MovieRepo: moviesRepo,
+	}
+
+	tokenService := userServices.NewTokenService(userRepo, tokenRepo, permissionsRepo, cfg.tokens.accessTTL, cfg.tokens.refreshTTL, authority)
+	userService := userServices.NewUserService(userRepo, tokenRepo, roleRepo, apiKeysRepo, tokenService, cfg.roles.defaultRole, logger, mailer)
+	mfaService := userServices.NewMFAService(userRepos.NewTOTPSqlxRepo(db), "Greenlight")
+	loginGuard := newLoginGuard(cfg, db)
+
 	userHandler := &userHandlers.UserHandler{
 		Logger:          logger,
-		UserRepo:        userRepos.NewUserSqlxRepo(db),
-		TokenRepo:       userRepos.NewTokenSqlxRepo(db),
-		PermissionsRepo: permissionsRepo.NewSqlxRepo(db),
-		Mailer:          mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		UserRepo:        userRepo,
+		TokenRepo:       tokenRepo,
+		PermissionsRepo: permissionsRepo,
+		Mailer:          mailer,
+		UserService:     userService,
 	}
 
 	tokenHandler := &userHandlers.TokenHandler{
-		UserRepo:  userRepos.NewUserSqlxRepo(db),
-		TokenRepo: userRepos.NewTokenSqlxRepo(db),
+		UserRepo:           userRepo,
+		TokenRepo:          tokenRepo,
+		Logger:             logger,
+		Mailer:             mailer,
+		UserService:        userService,
+		TokenService:       tokenService,
+		MFAService:         mfaService,
+		ActivationThrottle: throttle.New(cfg.activation.resendLimit, cfg.activation.resendWindow),
+		LoginGuard:         loginGuard,
+		MagicLinkThrottle:  throttle.New(cfg.magicLink.limit, cfg.magicLink.window),
+		MagicLinkURL:       cfg.magicLink.url,
+		SecureCookies:      cfg.cookies.secure,
+	}
+
+	mfaHandler := &userHandlers.MFAHandler{
+		UserRepo:   userRepo,
+		MFAService: mfaService,
+	}
+
+	oidcHandler := &userHandlers.OIDCHandler{
+		TokenRepo:     tokenRepo,
+		TokenService:  tokenService,
+		MFAService:    mfaService,
+		SecureCookies: cfg.cookies.secure,
+	}
+
+	if cfg.oidc.issuer != "" {
+		oidcHandler.OIDCService, err = newOIDCService(cfg, db, userRepo, roleRepo, permissionsRepo, mfaService)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	adminHandler := &userHandlers.AdminHandler{
+		UserRepo:     userRepo,
+		UserService:  userService,
+		TokenService: tokenService,
+		APIKeyRepo:   apiKeysRepo,
+		LoginGuard:   loginGuard,
+	}
+
+	apiKeysHandler := &apiKeysHandler.Handler{
+		Repo:            apiKeysRepo,
+		PermissionsRepo: permissionsRepo,
+	}
+
+	permissionsHandler := &permissionsHandler.Handler{
+		Repo:         permissionsRepo,
+		RoleRepo:     roleRepo,
+		UserRepo:     userRepo,
+		TokenService: tokenService,
+		DefaultRole:  cfg.roles.defaultRole,
 	}
 
 	info := Info{
 		healthcheckHandler: healtcheckHandler,
 		moviesHandler:      moviesHandler,
+		peopleHandler:      peopleHandler,
+		genresHandler:      genresHandler,
+		reviewsHandler:     reviewsHandler,
+		watchlistsHandler:  watchlistsHandler,
 		userHandler:        userHandler,
 		tokenHandler:       tokenHandler,
-		userRepo:           userRepos.NewUserSqlxRepo(db),
-		permissionsRepo:    permissionsRepo.NewSqlxRepo(db),
+		mfaHandler:         mfaHandler,
+		oidcHandler:        oidcHandler,
+		adminHandler:       adminHandler,
+		apiKeysHandler:     apiKeysHandler,
+		apiKeysRepo:        apiKeysRepo,
+		userRepo:           userRepo,
+		permissionsRepo:    permissionsRepo,
+		permissionsHandler: permissionsHandler,
+		authority:          authority,
 		logger:             logger,
 		cfg:                cfg,
 	}
@@ -134,6 +362,117 @@ func addMetrics(db *sqlx.DB) {
 	}))
 }
 
+// openTokenAuthority sets up signing of stateless authentication tokens, with revocations kept
+// in the token_denylist and token_denylist_cutoffs tables.
+func openTokenAuthority(cfg config, db *sqlx.DB, logger *jsonlog.Logger) (*signedtoken.Authority, error) {
+	keys, err := signedtoken.ParseKeys(cfg.tokens.signingKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	denylist, err := signedtoken.NewDenylist(userRepos.NewDenylistSqlxRepo(db), 30*time.Second, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return signedtoken.NewAuthority(keys, denylist)
+}
+
+// newOIDCService discovers the configured identity provider, whose issuer URL also names the
+// identities linked to it.
+func newOIDCService(cfg config, db *sqlx.DB, userRepo *userRepos.UserRepo, roleRepo *permissionsRepo.RoleRepo, permissionsRepo *permissionsRepo.Repo, mfaService *userServices.MFAService) (*userServices.OIDCService, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider, err := oidc.Discover(ctx, oidc.Config{
+		Issuer:       cfg.oidc.issuer,
+		ClientID:     cfg.oidc.clientID,
+		ClientSecret: cfg.oidc.clientSecret,
+		RedirectURL:  cfg.oidc.redirectURL,
+	}, &http.Client{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	identityRepo := userRepos.NewIdentitySqlxRepo(db)
+
+	return userServices.NewOIDCService(userRepo, identityRepo, roleRepo, permissionsRepo, mfaService, provider, cfg.oidc.issuer, cfg.roles.defaultRole, splitCSV(cfg.oidc.defaultPermissions)), nil
+}
+
+// checkDefaultGrants makes sure the role and permissions new users get exist, assigning missing
+// ones would silently grant nothing.
+func checkDefaultGrants(cfg config, roleRepo *permissionsRepo.RoleRepo, permissionsRepo *permissionsRepo.Repo) error {
+	unknown, err := roleRepo.GetUnknown(cfg.roles.defaultRole)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("default role %q doesn't exist", cfg.roles.defaultRole)
+	}
+
+	codes := splitCSV(cfg.oidc.defaultPermissions)
+	if len(codes) == 0 {
+		return nil
+	}
+
+	unknown, err = permissionsRepo.GetUnknown(codes...)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown OIDC default permissions: %s", strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+func splitCSV(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// newPasswordPolicy opens the breached password list, when one is configured, for the policy
+// new passwords have to follow.
+func newPasswordPolicy(cfg config, logger *jsonlog.Logger) (*passwordpolicy.Policy, error) {
+	if cfg.passwords.breached == "" {
+		return passwordpolicy.New(cfg.passwords.minEntropy, nil), nil
+	}
+
+	breached, err := passwordpolicy.OpenBreachedList(cfg.passwords.breached, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return passwordpolicy.New(cfg.passwords.minEntropy, breached), nil
+}
+
+// newLoginGuard throttles failed logins per account and, ten times more leniently, per IP, so a
+// single IP can't guess passwords for many accounts either. Second factor codes get five tries,
+// after which every wrong code locks them again.
+func newLoginGuard(cfg config, db *sqlx.DB) *userServices.LoginGuard {
+	emailPolicy := userServices.LoginPolicy{
+		BackoffAfter: cfg.login.backoffAfter,
+		LockAfter:    cfg.login.lockAfter,
+		LockDuration: cfg.login.lockDuration,
+		Window:       cfg.login.window,
+	}
+
+	ipPolicy := emailPolicy
+	ipPolicy.BackoffAfter *= 10
+	ipPolicy.LockAfter *= 10
+
+	mfaPolicy := emailPolicy
+	mfaPolicy.BackoffAfter = 5
+	mfaPolicy.LockAfter = 5
+
+	return userServices.NewLoginGuard(userRepos.NewLoginAttemptSqlxRepo(db), emailPolicy, ipPolicy, mfaPolicy)
+}
+
 func openDB(cfg config) (*sqlx.DB, error) {
 	db, err := sqlx.Connect("postgres", cfg.db.dsn)
 	if err != nil {
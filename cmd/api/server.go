@@ -10,18 +10,32 @@ import (
 	"syscall"
 	"time"
 
+	apiKeysHandler "greenlight/internal/apikeys/handlers"
+	apiKeysRepo "greenlight/internal/apikeys/repo"
+	apiKeysRouter "greenlight/internal/apikeys/router"
+	genresHandler "greenlight/internal/genres/handlers"
+	genresRouter "greenlight/internal/genres/router"
 	healthcheckHandler "greenlight/internal/healthcheck/handlers"
 	healthcheckRouter "greenlight/internal/healthcheck/router"
 	metricsRoutes "greenlight/internal/metrics"
 	moviesHandler "greenlight/internal/movies/handlers"
 	moviesRouter "greenlight/internal/movies/router"
+	peopleHandler "greenlight/internal/people/handlers"
+	peopleRouter "greenlight/internal/people/router"
+	permissionsHandler "greenlight/internal/permissions/handlers"
 	permissionsRepo "greenlight/internal/permissions/repo"
+	permissionsRouter "greenlight/internal/permissions/router"
+	reviewsHandler "greenlight/internal/reviews/handlers"
+	reviewsRouter "greenlight/internal/reviews/router"
 	userHandler "greenlight/internal/users/handlers"
 	userRepo "greenlight/internal/users/repo"
 	userRouter "greenlight/internal/users/router"
+	watchlistsHandler "greenlight/internal/watchlists/handlers"
+	watchlistsRouter "greenlight/internal/watchlists/router"
 	"greenlight/pkg/httphelpers"
 	"greenlight/pkg/jsonlog"
 	"greenlight/pkg/middlewares"
+	"greenlight/pkg/signedtoken"
 	"greenlight/pkg/taskutils"
 
 	"github.com/gin-gonic/gin"
@@ -30,10 +44,21 @@ import (
 type Info struct {
 	healthcheckHandler *healthcheckHandler.Handler
 	moviesHandler      *moviesHandler.Handler
+	peopleHandler      *peopleHandler.Handler
+	genresHandler      *genresHandler.Handler
+	reviewsHandler     *reviewsHandler.Handler
+	watchlistsHandler  *watchlistsHandler.Handler
 	userHandler        *userHandler.UserHandler
 	userRepo           *userRepo.UserRepo
 	permissionsRepo    *permissionsRepo.Repo
+	permissionsHandler *permissionsHandler.Handler
+	authority          *signedtoken.Authority
 	tokenHandler       *userHandler.TokenHandler
+	mfaHandler         *userHandler.MFAHandler
+	oidcHandler        *userHandler.OIDCHandler
+	adminHandler       *userHandler.AdminHandler
+	apiKeysHandler     *apiKeysHandler.Handler
+	apiKeysRepo        *apiKeysRepo.Repo
 	logger             *jsonlog.Logger
 	cfg                config
 }
@@ -107,13 +132,19 @@ func startRouter(info Info) *gin.Engine {
 	engine.Use(middlewares.RecoverPanic())
 	engine.Use(middlewares.EnableCORS())
 	engine.Use(middlewares.RateLimit(int(info.cfg.limiter.rps), info.cfg.limiter.burst, info.cfg.limiter.enabled, info.logger))
-	engine.Use(middlewares.Authenticate(info.userRepo))
+	engine.Use(middlewares.Authenticate(info.userRepo, info.authority, info.apiKeysRepo))
 
 	v1 := engine.Group("/v1")
 	{
 		healthcheckRouter.InitRouter(v1, info.healthcheckHandler)
 		moviesRouter.InitRouter(v1, info.moviesHandler, info.permissionsRepo)
-		userRouter.InitRouter(v1, info.userHandler, info.tokenHandler)
+		peopleRouter.InitRouter(v1, info.peopleHandler, info.permissionsRepo)
+		genresRouter.InitRouter(v1, info.genresHandler, info.permissionsRepo)
+		reviewsRouter.InitRouter(v1, info.reviewsHandler, info.permissionsRepo)
+		watchlistsRouter.InitRouter(v1, info.watchlistsHandler, info.permissionsRepo)
+		userRouter.InitRouter(v1, info.userHandler, info.tokenHandler, info.mfaHandler, info.oidcHandler, info.adminHandler, info.permissionsRepo)
+		apiKeysRouter.InitRouter(v1, info.apiKeysHandler)
+		permissionsRouter.InitRouter(v1, info.permissionsHandler, info.permissionsRepo)
 		metricsRoutes.InitRouter(engine)
 	}
 
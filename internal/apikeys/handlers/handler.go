@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"greenlight/internal/apikeys/models"
+	permissionsModels "greenlight/internal/permissions/models"
+	"greenlight/internal/repositoryerrors"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Repo interface {
+	Insert(key *models.APIKey) error
+	GetAllForUser(userID int64) ([]*models.APIKey, error)
+	Delete(id, userID int64) error
+}
+
+type PermissionsRepo interface {
+	GetAllForUser(userID int64) (permissionsModels.Permissions, error)
+}
+
+type Handler struct {
+	Repo            Repo
+	PermissionsRepo PermissionsRepo
+}
+
+type createAPIKeyInput struct {
+	Name        string     `json:"name"`
+	Permissions []string   `json:"permissions"`
+	Expiry      *time.Time `json:"expiry"`
+}
+
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	var input createAPIKeyInput
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	user := httphelpers.ContextGetUser(c)
+
+	if input.Permissions == nil {
+		input.Permissions = []string{}
+	}
+
+	key, err := models.GenerateAPIKey(user.ID, input.Name, input.Permissions, input.Expiry)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	v := validator.New()
+
+	if models.ValidateAPIKey(v, key); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	permissions, err := h.PermissionsRepo.GetAllForUser(user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	for _, code := range key.Permissions {
+		v.Check(permissions.Include(code), "permissions", "must only contain permissions you hold")
+	}
+
+	if !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	err = h.Repo.Insert(key)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusCreated, gin.H{"api_key": key}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	user := httphelpers.ContextGetUser(c)
+
+	keys, err := h.Repo.GetAllForUser(user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"api_keys": keys}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) DeleteAPIKey(c *gin.Context) {
+	id, err := httphelpers.ReadIDParam(c)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return
+	}
+
+	user := httphelpers.ContextGetUser(c)
+
+	err = h.Repo.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "api key successfully revoked"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
@@ -0,0 +1,200 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"greenlight/internal/apikeys/models"
+	"greenlight/internal/repositoryerrors"
+	userModels "greenlight/internal/users/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type Repo struct {
+	DB *sqlx.DB
+}
+
+func NewSqlxRepo(db *sqlx.DB) *Repo {
+	return &Repo{
+		DB: db,
+	}
+}
+
+func (r *Repo) Insert(key *models.APIKey) error {
+	query := `
+	INSERT INTO api_keys (user_id, name, prefix, hash, permissions, expiry)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at`
+
+	args := []any{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array(key.Permissions), key.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return r.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (r *Repo) GetAllForUser(userID int64) ([]*models.APIKey, error) {
+	query := `
+	SELECT id, user_id, name, prefix, permissions, expiry, last_used_at, created_at
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+
+	for rows.Next() {
+		var key models.APIKey
+
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Permissions),
+			&key.Expiry,
+			&key.LastUsedAt,
+			&key.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetForPlaintext returns an unexpired key together with the user owning it. The permissions of
+// the key are expanded with every code they imply, however indirectly, like the permissions of
+// users, so a key scoped to a code covers what the code covers.
+func (r *Repo) GetForPlaintext(plaintext string) (*models.APIKey, *userModels.User, error) {
+	query := `
+	SELECT api_keys.id, api_keys.name, api_keys.prefix,
+		ARRAY(
+			WITH RECURSIVE scope (permission_id) AS (
+				SELECT permissions.id
+				FROM permissions
+				WHERE permissions.code = ANY(api_keys.permissions)
+				UNION
+				SELECT permissions_implications.implied_permission_id
+				FROM permissions_implications
+				INNER JOIN scope ON scope.permission_id = permissions_implications.permission_id
+			)
+			SELECT permissions.code
+			FROM permissions
+			INNER JOIN scope ON scope.permission_id = permissions.id
+			ORDER BY permissions.code
+		),
+		api_keys.expiry,
+		api_keys.last_used_at, api_keys.created_at,
+		users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.suspended, users.version
+	FROM api_keys
+	INNER JOIN users ON users.id = api_keys.user_id
+	WHERE api_keys.hash = $1
+	AND (api_keys.expiry IS NULL OR api_keys.expiry > $2)
+	AND NOT users.suspended`
+
+	var (
+		key  models.APIKey
+		user userModels.User
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, models.HashAPIKey(plaintext), time.Now()).Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Permissions),
+		&key.Expiry,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.Hash,
+		&user.Activated,
+		&user.Suspended,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, repositoryerrors.ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	key.UserID = user.ID
+
+	return &key, &user, nil
+}
+
+// Touch records that the key was just used. To save writes, it is only updated once a minute.
+func (r *Repo) Touch(id int64) error {
+	query := `
+	UPDATE api_keys
+	SET last_used_at = NOW()
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *Repo) Delete(id, userID int64) error {
+	query := `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return repositoryerrors.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAllForUser deletes every key of a user
+func (r *Repo) DeleteAllForUser(userID int64) error {
+	query := `DELETE FROM api_keys WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,22 @@
+package router
+
+import (
+	"greenlight/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	CreateAPIKey(c *gin.Context)
+	ListAPIKeys(c *gin.Context)
+	DeleteAPIKey(c *gin.Context)
+}
+
+func InitRouter(engine *gin.RouterGroup, handler Handler) {
+	apiKeys := engine.Group("/api-keys")
+	{
+		apiKeys.POST("", middlewares.RequireActivatedUser(middlewares.RequireUserCredentials(handler.CreateAPIKey)))
+		apiKeys.GET("", middlewares.RequireActivatedUser(middlewares.RequireUserCredentials(handler.ListAPIKeys)))
+		apiKeys.DELETE("/:id", middlewares.RequireActivatedUser(middlewares.RequireUserCredentials(handler.DeleteAPIKey)))
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"greenlight/internal/genres/models"
+	"greenlight/internal/repositoryerrors"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Repo interface {
+	GetAll() ([]*models.Genre, error)
+	Get(slug string) (*models.Genre, error)
+	GetResolver() (*models.Resolver, error)
+	Insert(genre *models.Genre) error
+	Update(genre *models.Genre) error
+	Delete(slug string) error
+}
+
+type Handler struct {
+	Repo Repo
+}
+
+func (h *Handler) ListGenres(c *gin.Context) {
+	genres, err := h.Repo.GetAll()
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"genres": genres}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) ShowGenre(c *gin.Context) {
+	genre, ok := h.genreParam(c)
+	if !ok {
+		return
+	}
+
+	err := httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"genre": genre}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) CreateGenre(c *gin.Context) {
+	var input struct {
+		Slug    string   `json:"slug"`
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	if input.Aliases == nil {
+		input.Aliases = []string{}
+	}
+
+	genre := &models.Genre{
+		Slug:    input.Slug,
+		Name:    input.Name,
+		Aliases: input.Aliases,
+	}
+
+	v, ok := h.validate(c, genre)
+	if !ok {
+		return
+	}
+
+	err = h.Repo.Insert(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrDuplicateSlug):
+			v.AddError("slug", "a genre with this slug or alias already exists")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/genres/%s", genre.Slug))
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusCreated, gin.H{"genre": genre}, headers)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// UpdateGenre changes the name and aliases of a genre. The slug is what movies store, so it
+// can't be changed.
+func (h *Handler) UpdateGenre(c *gin.Context) {
+	genre, ok := h.genreParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name    *string  `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	if input.Name != nil {
+		genre.Name = *input.Name
+	}
+	if input.Aliases != nil {
+		genre.Aliases = input.Aliases
+	}
+
+	v, ok := h.validate(c, genre)
+	if !ok {
+		return
+	}
+
+	err = h.Repo.Update(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrDuplicateSlug):
+			v.AddError("aliases", "already used by another genre")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"genre": genre}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// DeleteGenre deletes a genre no movie uses anymore
+func (h *Handler) DeleteGenre(c *gin.Context) {
+	err := h.Repo.Delete(c.Param("slug"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		case errors.Is(err, repositoryerrors.ErrRecordInUse):
+			v := validator.New()
+			v.AddError("slug", "the genre is still used by movies")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "genre successfully deleted"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) validate(c *gin.Context, genre *models.Genre) (*validator.Validator, bool) {
+	resolver, err := h.Repo.GetResolver()
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return nil, false
+	}
+
+	v := validator.New()
+
+	if models.ValidateGenre(v, genre, resolver); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return nil, false
+	}
+
+	return v, true
+}
+
+func (h *Handler) genreParam(c *gin.Context) (*models.Genre, bool) {
+	genre, err := h.Repo.Get(c.Param("slug"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return nil, false
+	}
+
+	return genre, true
+}
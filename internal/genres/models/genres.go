@@ -0,0 +1,82 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+
+	"greenlight/pkg/validator"
+)
+
+var (
+	SlugRX       = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	nonSlugRunRX = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Genre is a canonical genre. Movies store its slug, and any of its aliases, or spellings that
+// slugify to either, are accepted in its place.
+type Genre struct {
+	ID      int64    `json:"id"`
+	Slug    string   `json:"slug"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+// Slugify lowercases s and replaces every run of other characters than letters and digits with a
+// dash, so "Sci-Fi", "sci fi" and "SCI_FI" all become "sci-fi".
+func Slugify(s string) string {
+	return strings.Trim(nonSlugRunRX.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// Resolver maps genre spellings to canonical slugs
+type Resolver struct {
+	slugs map[string]string
+}
+
+func NewResolver(genres []*Genre) *Resolver {
+	r := &Resolver{slugs: make(map[string]string)}
+
+	for _, genre := range genres {
+		r.slugs[genre.Slug] = genre.Slug
+		for _, alias := range genre.Aliases {
+			r.slugs[alias] = genre.Slug
+		}
+	}
+
+	return r
+}
+
+// Resolve returns the slug of the genre name refers to, by slug or alias
+func (r *Resolver) Resolve(name string) (string, bool) {
+	slug, ok := r.slugs[Slugify(name)]
+	return slug, ok
+}
+
+// ValidateGenre checks a genre, and that none of its slug and aliases already refer to another
+// genre.
+func ValidateGenre(v *validator.Validator, genre *Genre, resolver *Resolver) {
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(len(genre.Slug) <= 100, "slug", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(genre.Slug, SlugRX), "slug", "must only contain lowercase letters and digits separated by single dashes")
+
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(genre.Aliases != nil, "aliases", "must be provided")
+	v.Check(len(genre.Aliases) <= 20, "aliases", "must not contain more than 20 aliases")
+	v.Check(validator.Unique(genre.Aliases), "aliases", "must not contain duplicate values")
+
+	for _, alias := range genre.Aliases {
+		v.Check(validator.Matches(alias, SlugRX), "aliases", "must only contain lowercase letters and digits separated by single dashes")
+		v.Check(alias != genre.Slug, "aliases", "must not contain the slug")
+	}
+
+	if slug, ok := resolver.Resolve(genre.Slug); ok && slug != genre.Slug {
+		v.AddError("slug", "already an alias of the genre "+slug)
+	}
+
+	for _, alias := range genre.Aliases {
+		if slug, ok := resolver.Resolve(alias); ok && slug != genre.Slug {
+			v.AddError("aliases", "already used by the genre "+slug)
+		}
+	}
+}
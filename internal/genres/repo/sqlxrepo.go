@@ -0,0 +1,202 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"greenlight/internal/genres/models"
+	"greenlight/internal/repositoryerrors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type Repo struct {
+	DB *sqlx.DB
+}
+
+func NewSqlxRepo(db *sqlx.DB) *Repo {
+	return &Repo{
+		DB: db,
+	}
+}
+
+func (r *Repo) GetAll() ([]*models.Genre, error) {
+	query := `
+	SELECT genres.id, genres.slug, genres.name, array_remove(array_agg(genre_aliases.alias ORDER BY genre_aliases.alias), NULL)
+	FROM genres
+	LEFT JOIN genre_aliases ON genre_aliases.genre_id = genres.id
+	GROUP BY genres.id
+	ORDER BY genres.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*models.Genre{}
+
+	for rows.Next() {
+		var genre models.Genre
+		if err := rows.Scan(&genre.ID, &genre.Slug, &genre.Name, pq.Array(&genre.Aliases)); err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+func (r *Repo) Get(slug string) (*models.Genre, error) {
+	query := `
+	SELECT genres.id, genres.slug, genres.name, array_remove(array_agg(genre_aliases.alias ORDER BY genre_aliases.alias), NULL)
+	FROM genres
+	LEFT JOIN genre_aliases ON genre_aliases.genre_id = genres.id
+	WHERE genres.slug = $1
+	GROUP BY genres.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var genre models.Genre
+
+	err := r.DB.QueryRowContext(ctx, query, slug).Scan(&genre.ID, &genre.Slug, &genre.Name, pq.Array(&genre.Aliases))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, repositoryerrors.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &genre, nil
+}
+
+// GetResolver loads every genre into a Resolver
+func (r *Repo) GetResolver() (*models.Resolver, error) {
+	genres, err := r.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	return models.NewResolver(genres), nil
+}
+
+// Insert creates a genre with its aliases. A slug or alias already taken gives ErrDuplicateSlug.
+func (r *Repo) Insert(genre *models.Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO genres (slug, name) VALUES ($1, $2) RETURNING id`, genre.Slug, genre.Name).Scan(&genre.ID)
+	if err != nil {
+		return duplicateSlugError(err)
+	}
+
+	err = insertAliases(ctx, tx, genre)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Update saves the name of a genre and replaces its aliases, the slug never changes
+func (r *Repo) Update(genre *models.Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE genres SET name = $1 WHERE id = $2`, genre.Name, genre.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM genre_aliases WHERE genre_id = $1`, genre.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertAliases(ctx, tx, genre)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertAliases(ctx context.Context, tx *sqlx.Tx, genre *models.Genre) error {
+	query := `
+	INSERT INTO genre_aliases (alias, genre_id)
+	SELECT alias, $1 FROM unnest($2::text[]) AS alias`
+
+	_, err := tx.ExecContext(ctx, query, genre.ID, pq.Array(genre.Aliases))
+	if err != nil {
+		return duplicateSlugError(err)
+	}
+
+	return nil
+}
+
+func duplicateSlugError(err error) error {
+	switch err.Error() {
+	case `pq: duplicate key value violates unique constraint "genres_slug_key"`,
+		`pq: duplicate key value violates unique constraint "genre_aliases_pkey"`:
+		return repositoryerrors.ErrDuplicateSlug
+	default:
+		return err
+	}
+}
+
+// Delete removes a genre and its aliases. Genres still used by a movie give ErrRecordInUse.
+func (r *Repo) Delete(slug string) error {
+	query := `
+	WITH deleted AS (
+		DELETE FROM genres
+		WHERE slug = $1
+		AND NOT EXISTS (SELECT 1 FROM movies WHERE movies.genres @> ARRAY[$1])
+		RETURNING id
+	)
+	SELECT
+		EXISTS (SELECT 1 FROM deleted),
+		EXISTS (SELECT 1 FROM genres WHERE slug = $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var deleted, exists bool
+
+	err := r.DB.QueryRowContext(ctx, query, slug).Scan(&deleted, &exists)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case deleted:
+		return nil
+	case exists:
+		return repositoryerrors.ErrRecordInUse
+	default:
+		return repositoryerrors.ErrRecordNotFound
+	}
+}
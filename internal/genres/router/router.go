@@ -0,0 +1,39 @@
+package router
+
+import (
+	"greenlight/internal/permissions/models"
+	"greenlight/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	ListGenres(c *gin.Context)
+	ShowGenre(c *gin.Context)
+	CreateGenre(c *gin.Context)
+	UpdateGenre(c *gin.Context)
+	DeleteGenre(c *gin.Context)
+}
+
+type PermissionsRepo interface {
+	GetAllForUser(userID int64) (models.Permissions, error)
+}
+
+func InitRouter(engine *gin.RouterGroup, handler Handler, permissionsRepo PermissionsRepo) {
+	genres := engine.Group("/genres")
+	{
+		genres.GET("", requireReadPermission(permissionsRepo), handler.ListGenres)
+		genres.GET("/:slug", requireReadPermission(permissionsRepo), handler.ShowGenre)
+		genres.POST("", requireAdminPermission(permissionsRepo), handler.CreateGenre)
+		genres.PATCH("/:slug", requireAdminPermission(permissionsRepo), handler.UpdateGenre)
+		genres.DELETE("/:slug", requireAdminPermission(permissionsRepo), handler.DeleteGenre)
+	}
+}
+
+func requireAdminPermission(permissionsRepo PermissionsRepo) gin.HandlerFunc {
+	return middlewares.RequirePermission(permissionsRepo, "movies:admin")
+}
+
+func requireReadPermission(permissionsRepo PermissionsRepo) gin.HandlerFunc {
+	return middlewares.RequirePermission(permissionsRepo, "movies:read")
+}
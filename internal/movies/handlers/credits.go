@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	peopleModels "greenlight/internal/people/models"
+	"greenlight/internal/repositoryerrors"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) CreateCredit(c *gin.Context) {
+	movie, ok := h.movieParam(c)
+	if !ok {
+		return
+	}
+
+	if !h.requireAccess(c, movie) {
+		return
+	}
+
+	var input struct {
+		PersonID     int64  `json:"person_id"`
+		Role         string `json:"role"`
+		Character    string `json:"character"`
+		BillingOrder int32  `json:"billing_order"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	credit := &peopleModels.Credit{
+		MovieID:      movie.ID,
+		PersonID:     input.PersonID,
+		Role:         input.Role,
+		Character:    input.Character,
+		BillingOrder: input.BillingOrder,
+	}
+
+	v := validator.New()
+
+	if peopleModels.ValidateCredit(v, credit); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	err = h.CreditRepo.InsertCredit(credit)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			v.AddError("person_id", "no person with this id")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		case errors.Is(err, repositoryerrors.ErrDuplicateCredit):
+			v.AddError("person_id", "the person already has this credit in the movie")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.StatusCreatedJSONPayload(c, gin.H{"credit": credit})
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) DeleteCredit(c *gin.Context) {
+	movie, ok := h.movieParam(c)
+	if !ok {
+		return
+	}
+
+	if !h.requireAccess(c, movie) {
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("credit_id"), 10, 64)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return
+	}
+
+	err = h.CreditRepo.DeleteCredit(movie.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "credit successfully deleted"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
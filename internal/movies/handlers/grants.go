@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"greenlight/internal/movies/models"
+	"greenlight/internal/repositoryerrors"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) ListGrants(c *gin.Context) {
+	movie, ok := h.movieParam(c)
+	if !ok {
+		return
+	}
+
+	if !h.requireOwnership(c, movie) {
+		return
+	}
+
+	grants, err := h.Repo.GetGrants(movie.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"grants": grants}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// CreateGrant lets another user edit and delete the movie. Granting it twice is a no-op.
+func (h *Handler) CreateGrant(c *gin.Context) {
+	movie, ok := h.movieParam(c)
+	if !ok {
+		return
+	}
+
+	if !h.requireOwnership(c, movie) {
+		return
+	}
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.UserID > 0, "user_id", "must be provided")
+	v.Check(movie.CreatedBy == nil || input.UserID != *movie.CreatedBy, "user_id", "must not be the owner of the movie")
+
+	if !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	grant := &models.Grant{
+		MovieID: movie.ID,
+		UserID:  input.UserID,
+	}
+
+	err = h.Repo.AddGrant(grant)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			v.AddError("user_id", "no user with this id")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.StatusCreatedJSONPayload(c, gin.H{"grant": grant})
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) DeleteGrant(c *gin.Context) {
+	movie, ok := h.movieParam(c)
+	if !ok {
+		return
+	}
+
+	if !h.requireOwnership(c, movie) {
+		return
+	}
+
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return
+	}
+
+	err = h.Repo.RemoveGrant(movie.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "grant successfully deleted"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"net/http"
 
+	genreModels "greenlight/internal/genres/models"
 	"greenlight/internal/movies/models"
+	peopleModels "greenlight/internal/people/models"
+	permissionsModels "greenlight/internal/permissions/models"
 	"greenlight/internal/repositoryerrors"
 	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/middlewares"
 	"greenlight/pkg/validator"
 
 	"github.com/gin-gonic/gin"
@@ -23,14 +27,37 @@ type Logger interface {
 type Repo interface {
 	Insert(context.Context, *models.Movie) error
 	Get(id int64) (*models.Movie, error)
-	GetAll(title string, genres []string, filters httphelpers.Filters) ([]*models.Movie, httphelpers.Metadata, error)
+	GetAll(title string, spec httphelpers.FilterSpec, filters httphelpers.Filters) ([]*models.Movie, httphelpers.Metadata, error)
 	Update(movie models.Movie) (models.Movie, error)
 	Delete(id int64) error
+	HasGrant(movieID, userID int64) (bool, error)
+	GetGrants(movieID int64) ([]*models.Grant, error)
+	AddGrant(grant *models.Grant) error
+	RemoveGrant(movieID, userID int64) error
 }
 
+type GenreRepo interface {
+	GetResolver() (*genreModels.Resolver, error)
+}
+
+type CreditRepo interface {
+	GetCreditsForMovie(movieID int64) ([]*peopleModels.Credit, error)
+	InsertCredit(credit *peopleModels.Credit) error
+	DeleteCredit(movieID, id int64) error
+}
+
+type PermissionsRepo interface {
+	GetAllForUser(userID int64) (permissionsModels.Permissions, error)
+}
+
+// Handler serves the movies. Only the owner of a movie, users it was granted to and holders of
+// movies:admin can change it.
 type Handler struct {
-	Logger Logger
-	Repo   Repo
+	Logger          Logger
+	Repo            Repo
+	CreditRepo      CreditRepo
+	GenreRepo       GenreRepo
+	PermissionsRepo PermissionsRepo
 }
 
 type createMovieInput struct {
@@ -49,16 +76,25 @@ func (h *Handler) CreateMovie(c *gin.Context) {
 		return
 	}
 
+	user := httphelpers.ContextGetUser(c)
+
 	movie := &models.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:     input.Title,
+		Year:      input.Year,
+		Runtime:   input.Runtime,
+		Genres:    input.Genres,
+		CreatedBy: &user.ID,
+	}
+
+	genres, err := h.GenreRepo.GetResolver()
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
 	}
 
 	v := validator.New()
 
-	if models.ValidateMovie(v, movie); !v.Valid() {
+	if models.ValidateMovie(v, movie, genres); !v.Valid() {
 		httphelpers.StatusUnprocesableEntities(c, v.Errors)
 		return
 	}
@@ -80,6 +116,7 @@ func (h *Handler) CreateMovie(c *gin.Context) {
 	}
 }
 
+// ShowMovie responds with a movie, and with its credits too for ?include=credits
 func (h *Handler) ShowMovie(c *gin.Context) {
 	id, err := httphelpers.ReadIDParam(c)
 	if err != nil {
@@ -87,6 +124,18 @@ func (h *Handler) ShowMovie(c *gin.Context) {
 		return
 	}
 
+	v := validator.New()
+
+	include := httphelpers.ReadCSV(c.Request.URL.Query(), "include", []string{})
+	for _, value := range include {
+		v.Check(validator.PermittedValue(value, "credits"), "include", "invalid include value")
+	}
+
+	if !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
 	movie, err := h.Repo.Get(id)
 	if err != nil {
 		switch {
@@ -98,6 +147,14 @@ func (h *Handler) ShowMovie(c *gin.Context) {
 		return
 	}
 
+	if validator.PermittedValue("credits", include...) {
+		movie.Credits, err = h.CreditRepo.GetCreditsForMovie(movie.ID)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+	}
+
 	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"movie": movie}, nil)
 	if err != nil {
 		httphelpers.StatusInternalServerErrorResponse(c, err)
@@ -130,6 +187,10 @@ func (h *Handler) UpdateMovie(c *gin.Context) {
 		return
 	}
 
+	if !h.requireAccess(c, movie) {
+		return
+	}
+
 	err = httphelpers.JSONDecode(c, &input)
 	if err != nil {
 		httphelpers.StatusBadRequestResponse(c, err.Error())
@@ -149,9 +210,15 @@ func (h *Handler) UpdateMovie(c *gin.Context) {
 		movie.Genres = input.Genres
 	}
 
+	genres, err := h.GenreRepo.GetResolver()
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
 	v := validator.New()
 
-	if models.ValidateMovie(v, movie); !v.Valid() {
+	if models.ValidateMovie(v, movie, genres); !v.Valid() {
 		httphelpers.StatusUnprocesableEntities(c, v.Errors)
 		return
 	}
@@ -174,13 +241,16 @@ func (h *Handler) UpdateMovie(c *gin.Context) {
 }
 
 func (h *Handler) DeleteMovie(c *gin.Context) {
-	id, err := httphelpers.ReadIDParam(c)
-	if err != nil {
-		httphelpers.StatusNotFoundResponse(c)
+	movie, ok := h.movieParam(c)
+	if !ok {
+		return
+	}
+
+	if !h.requireAccess(c, movie) {
 		return
 	}
 
-	err = h.Repo.Delete(id)
+	err := h.Repo.Delete(movie.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
@@ -198,8 +268,8 @@ func (h *Handler) DeleteMovie(c *gin.Context) {
 }
 
 type listMoviesInput struct {
-	Title  string
-	Genres []string
+	Title string
+	Spec  httphelpers.FilterSpec
 	httphelpers.Filters
 }
 
@@ -209,22 +279,42 @@ func (h *Handler) ListMovies(c *gin.Context) {
 	qs := c.Request.URL.Query()
 
 	input := listMoviesInput{
-		Title:  httphelpers.ReadString(qs, "title", ""),
-		Genres: httphelpers.ReadCSV(qs, "genres", []string{}),
+		Title: httphelpers.ReadString(qs, "title", ""),
+		Spec: httphelpers.FilterSpec{
+			IntRanges: []httphelpers.IntRange{
+				httphelpers.ReadIntRange(qs, "year", v),
+				httphelpers.ReadIntRange(qs, "runtime", v),
+			},
+			TimeRanges: []httphelpers.TimeRange{
+				httphelpers.ReadTimeRange(qs, "created", v),
+			},
+			Sets: []httphelpers.SetFilter{
+				httphelpers.ReadSetFilter(qs, "genres"),
+			},
+		},
 		Filters: httphelpers.Filters{
 			Page:         httphelpers.ReadInt(qs, "page", 1, v),
 			PageSize:     httphelpers.ReadInt(qs, "page_size", 10, v),
 			Sort:         httphelpers.ReadString(qs, "sort", "id"),
-			SortSafeList: []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"},
+			SortSafeList: []string{"id", "title", "year", "runtime", "rating", "-id", "-title", "-year", "-runtime", "-rating"},
 		},
 	}
 
-	if httphelpers.ValidateFilters(v, input.Filters); !v.Valid() {
+	// Genres are resolved before validating, so an alias and its slug count as the same genre.
+	if genres := input.Spec.Set("genres"); genres != nil {
+		if err := h.resolveGenres(v, genres); err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+	}
+
+	httphelpers.ValidateFilters(v, input.Filters)
+	if httphelpers.ValidateFilterSpec(v, input.Spec); !v.Valid() {
 		httphelpers.StatusUnprocesableEntities(c, v.Errors)
 		return
 	}
 
-	movies, metadata, err := h.Repo.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := h.Repo.GetAll(input.Title, input.Spec, input.Filters)
 	if err != nil {
 		httphelpers.StatusInternalServerErrorResponse(c, err)
 		return
@@ -235,3 +325,106 @@ func (h *Handler) ListMovies(c *gin.Context) {
 		httphelpers.StatusInternalServerErrorResponse(c, err)
 	}
 }
+
+// resolveGenres replaces the genre names of filter with their slugs
+func (h *Handler) resolveGenres(v *validator.Validator, filter *httphelpers.SetFilter) error {
+	if len(filter.All) == 0 && len(filter.Any) == 0 && len(filter.Exclude) == 0 {
+		return nil
+	}
+
+	genres, err := h.GenreRepo.GetResolver()
+	if err != nil {
+		return err
+	}
+
+	for key, names := range map[string][]string{filter.Key: filter.All, filter.Key + "_any": filter.Any, filter.Key + "_exclude": filter.Exclude} {
+		for i, name := range names {
+			// Empty names are left for ValidateFilterSpec to report.
+			if name == "" {
+				continue
+			}
+
+			slug, ok := genres.Resolve(name)
+			if !ok {
+				v.AddError(key, fmt.Sprintf("unknown genre %q", name))
+				continue
+			}
+			names[i] = slug
+		}
+	}
+
+	return nil
+}
+
+var moviesAdmin = permissionsModels.MustParseExpression("movies:admin")
+
+// requireAccess responds with 403 unless the request user owns movie, was granted it, or holds
+// movies:admin
+func (h *Handler) requireAccess(c *gin.Context, movie *models.Movie) bool {
+	user := httphelpers.ContextGetUser(c)
+
+	if movie.CreatedBy != nil && *movie.CreatedBy == user.ID {
+		return true
+	}
+
+	allowed, err := middlewares.Allows(c, h.PermissionsRepo, moviesAdmin)
+	if err == nil && !allowed {
+		allowed, err = h.Repo.HasGrant(movie.ID, user.ID)
+	}
+
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return false
+	}
+
+	if !allowed {
+		httphelpers.StatusForbiddenResponse(c)
+		return false
+	}
+
+	return true
+}
+
+// requireOwnership responds with 403 unless the request user owns movie or holds movies:admin,
+// grantees can't pass their access on.
+func (h *Handler) requireOwnership(c *gin.Context, movie *models.Movie) bool {
+	user := httphelpers.ContextGetUser(c)
+
+	if movie.CreatedBy != nil && *movie.CreatedBy == user.ID {
+		return true
+	}
+
+	allowed, err := middlewares.Allows(c, h.PermissionsRepo, moviesAdmin)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return false
+	}
+
+	if !allowed {
+		httphelpers.StatusForbiddenResponse(c)
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) movieParam(c *gin.Context) (*models.Movie, bool) {
+	id, err := httphelpers.ReadIDParam(c)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return nil, false
+	}
+
+	movie, err := h.Repo.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return nil, false
+	}
+
+	return movie, true
+}
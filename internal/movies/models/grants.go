@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Grant lets a user other than the owner edit and delete a movie
+type Grant struct {
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -2,9 +2,11 @@ package models
 
 import (
 	"database/sql/driver"
+	"fmt"
 	"strings"
 	"time"
 
+	peopleModels "greenlight/internal/people/models"
 	"greenlight/pkg/validator"
 )
 
@@ -28,16 +30,26 @@ func (a CustomArray) Value() (driver.Value, error) {
 }
 
 type Movie struct {
-	ID        int64        `json:"id" db:"id"`
-	CreatedAt time.Time    `json:"-" db:"created_at"`
-	Title     string       `json:"title" db:"title"`
-	Year      int32        `json:"year,omitempty" db:"year"`
-	Runtime   Runtime      `json:"runtime,omitempty" db:"runtime"`
-	Genres    *CustomArray `json:"genres,omitempty" db:"genres"`
-	Version   int32        `json:"version" db:"version"`
+	ID          int64                  `json:"id" db:"id"`
+	CreatedAt   time.Time              `json:"-" db:"created_at"`
+	Title       string                 `json:"title" db:"title"`
+	Year        int32                  `json:"year,omitempty" db:"year"`
+	Runtime     Runtime                `json:"runtime,omitempty" db:"runtime"`
+	Genres      *CustomArray           `json:"genres,omitempty" db:"genres"`
+	Version     int32                  `json:"version" db:"version"`
+	CreatedBy   *int64                 `json:"created_by,omitempty" db:"created_by"`
+	Rating      float64                `json:"rating" db:"rating"`
+	RatingCount int32                  `json:"rating_count" db:"rating_count"`
+	Credits     []*peopleModels.Credit `json:"credits,omitempty" db:"-"`
 }
 
-func ValidateMovie(v *validator.Validator, movie *Movie) {
+// GenreResolver maps genre spellings, including aliases, to canonical genre slugs
+type GenreResolver interface {
+	Resolve(name string) (string, bool)
+}
+
+// ValidateMovie checks a movie and replaces its genres with their canonical slugs
+func ValidateMovie(v *validator.Validator, movie *Movie, genres GenreResolver) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
 
@@ -49,7 +61,21 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
 
 	v.Check(movie.Genres != nil, "genres", "must be provided")
+	if movie.Genres == nil {
+		return
+	}
+
 	v.Check(len(*movie.Genres) >= 1, "genres", "must contain at least 1 genre")
 	v.Check(len(*movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
+
+	for i, name := range *movie.Genres {
+		slug, ok := genres.Resolve(name)
+		if !ok {
+			v.AddError("genres", fmt.Sprintf("unknown genre %q", name))
+			continue
+		}
+		(*movie.Genres)[i] = slug
+	}
+
 	v.Check(validator.Unique(*movie.Genres), "genres", "must not contain duplicate values")
 }
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"greenlight/internal/movies/models"
@@ -27,14 +28,14 @@ func NewSqlxRepo(db *sqlx.DB) *sqlxRepo {
 
 func (r *sqlxRepo) Insert(ctx context.Context, movie *models.Movie) error {
 	query := `
-	INSERT INTO movies (title, year, runtime, genres) 
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO movies (title, year, runtime, genres, created_by) 
+	VALUES ($1, $2, $3, $4, $5)
 	RETURNING id, created_at, version`
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	row := r.db.QueryRowxContext(ctx, query, movie.Title, movie.Year, movie.Runtime, movie.Genres)
+	row := r.db.QueryRowxContext(ctx, query, movie.Title, movie.Year, movie.Runtime, movie.Genres, movie.CreatedBy)
 	if err := row.Err(); err != nil {
 		return err
 	}
@@ -53,7 +54,7 @@ func (r *sqlxRepo) Get(id int64) (*models.Movie, error) {
 	}
 
 	query := `
-	SELECT id, created_at, title, year, runtime, genres, version
+	SELECT id, created_at, title, year, runtime, genres, version, created_by, rating, rating_count
 	FROM movies
 	WHERE id = $1`
 
@@ -63,10 +64,6 @@ func (r *sqlxRepo) Get(id int64) (*models.Movie, error) {
 	defer cancel()
 
 	err := r.db.GetContext(ctx, &movie, query, id)
-	if err != nil {
-		return nil, err
-	}
-
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -79,8 +76,9 @@ func (r *sqlxRepo) Get(id int64) (*models.Movie, error) {
 	return &movie, nil
 }
 
-func scanMovie(row interface{ Scan(...any) error }, movie *models.Movie) error {
-	err := row.Scan(
+// scanMovie scans the movie columns of row, after any leading columns such as a window count
+func scanMovie(row interface{ Scan(...any) error }, movie *models.Movie, leading ...any) error {
+	dest := append(leading,
 		&movie.ID,
 		&movie.CreatedAt,
 		&movie.Title,
@@ -88,9 +86,12 @@ func scanMovie(row interface{ Scan(...any) error }, movie *models.Movie) error {
 		&movie.Runtime,
 		&movie.Genres,
 		&movie.Version,
+		&movie.CreatedBy,
+		&movie.Rating,
+		&movie.RatingCount,
 	)
 
-	return err
+	return row.Scan(dest...)
 }
 
 func (r *sqlxRepo) Update(movie models.Movie) (models.Movie, error) {
@@ -150,20 +151,79 @@ func (r *sqlxRepo) Delete(id int64) error {
 	return nil
 }
 
-func (r *sqlxRepo) GetAll(title string, genres []string, filters httphelpers.Filters) ([]*models.Movie, httphelpers.Metadata, error) {
+// movieFilterColumns maps the FilterSpec keys accepted by GetAll to their columns
+var movieFilterColumns = map[string]string{
+	"year":    "year",
+	"runtime": "runtime",
+	"created": "created_at",
+	"genres":  "genres",
+}
+
+func filterColumn(key string) string {
+	column, ok := movieFilterColumns[key]
+	if !ok {
+		panic("unsafe filter key: " + key)
+	}
+
+	return column
+}
+
+func (r *sqlxRepo) GetAll(title string, spec httphelpers.FilterSpec, filters httphelpers.Filters) ([]*models.Movie, httphelpers.Metadata, error) {
+	conditions := []string{"(to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')"}
+	args := []any{title}
+
+	// where adds a condition on column, with value bound to the next placeholder
+	where := func(format, column string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, column, len(args)))
+	}
+
+	for _, rng := range spec.IntRanges {
+		column := filterColumn(rng.Key)
+		if rng.Min != nil {
+			where("%s >= $%d", column, *rng.Min)
+		}
+		if rng.Max != nil {
+			where("%s <= $%d", column, *rng.Max)
+		}
+	}
+
+	for _, rng := range spec.TimeRanges {
+		column := filterColumn(rng.Key)
+		if rng.After != nil {
+			where("%s > $%d", column, *rng.After)
+		}
+		if rng.Before != nil {
+			where("%s < $%d", column, *rng.Before)
+		}
+	}
+
+	for _, set := range spec.Sets {
+		column := filterColumn(set.Key)
+		if len(set.All) > 0 {
+			where("%s @> $%d", column, pq.Array(set.All))
+		}
+		if len(set.Any) > 0 {
+			where("%s && $%d", column, pq.Array(set.Any))
+		}
+		if len(set.Exclude) > 0 {
+			where("NOT (%s && $%d)", column, pq.Array(set.Exclude))
+		}
+	}
+
+	args = append(args, filters.Limit(), filters.Offset())
+
 	query := fmt.Sprintf(`
-			SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+			SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, created_by, rating, rating_count
 			FROM movies
-			WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-			AND (genres @> $2 OR $2 = '{}')
+			WHERE %s
 			ORDER BY %s %s, id ASC
-			LIMIT $3 OFFSET $4`, filters.SortColumn(), filters.SortDirection())
+			LIMIT $%d OFFSET $%d`,
+		strings.Join(conditions, "\n\t\t\tAND "), filters.SortColumn(), filters.SortDirection(), len(args)-1, len(args))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filters.Limit(), filters.Offset()}
-
 	rows, err := r.db.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, httphelpers.Metadata{}, err
@@ -177,7 +237,7 @@ func (r *sqlxRepo) GetAll(title string, genres []string, filters httphelpers.Fil
 	for rows.Next() {
 		var movie models.Movie
 
-		err := scanMovie(rows, &movie)
+		err := scanMovie(rows, &movie, &totalRecords)
 		if err != nil {
 			return nil, httphelpers.Metadata{}, err
 		}
@@ -193,3 +253,100 @@ func (r *sqlxRepo) GetAll(title string, genres []string, filters httphelpers.Fil
 
 	return movies, metadata, nil
 }
+
+// HasGrant reports whether a user was granted access to a movie
+func (r *sqlxRepo) HasGrant(movieID, userID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM movie_grants WHERE movie_id = $1 AND user_id = $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+
+	err := r.db.QueryRowContext(ctx, query, movieID, userID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *sqlxRepo) GetGrants(movieID int64) ([]*models.Grant, error) {
+	query := `
+	SELECT movie_id, user_id, created_at
+	FROM movie_grants
+	WHERE movie_id = $1
+	ORDER BY created_at, user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []*models.Grant{}
+
+	for rows.Next() {
+		var grant models.Grant
+		if err := rows.Scan(&grant.MovieID, &grant.UserID, &grant.CreatedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, &grant)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+// AddGrant grants a user access to a movie. Granting it again keeps the original grant, and an
+// unknown user gives ErrRecordNotFound.
+func (r *sqlxRepo) AddGrant(grant *models.Grant) error {
+	query := `
+	INSERT INTO movie_grants (movie_id, user_id)
+	VALUES ($1, $2)
+	ON CONFLICT (movie_id, user_id) DO UPDATE SET created_at = movie_grants.created_at
+	RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, grant.MovieID, grant.UserID).Scan(&grant.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "movie_grants" violates foreign key constraint "movie_grants_user_id_fkey"`:
+			return repositoryerrors.ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *sqlxRepo) RemoveGrant(movieID, userID int64) error {
+	query := `DELETE FROM movie_grants WHERE movie_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, movieID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return repositoryerrors.ErrRecordNotFound
+	}
+
+	return nil
+}
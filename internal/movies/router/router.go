@@ -13,6 +13,11 @@ type Handler interface {
 	UpdateMovie(c *gin.Context)
 	DeleteMovie(c *gin.Context)
 	ListMovies(c *gin.Context)
+	ListGrants(c *gin.Context)
+	CreateGrant(c *gin.Context)
+	DeleteGrant(c *gin.Context)
+	CreateCredit(c *gin.Context)
+	DeleteCredit(c *gin.Context)
 }
 
 type PermissionsRepo interface {
@@ -26,7 +31,12 @@ func InitRouter(engine *gin.RouterGroup, handler Handler, permissionsRepo Permis
 		movies.GET("", requireReadPermission(permissionsRepo), handler.ListMovies)
 		movies.GET("/:id", requireReadPermission(permissionsRepo), handler.ShowMovie)
 		movies.PATCH("/:id", requireWritePermission(permissionsRepo), handler.UpdateMovie)
-		movies.DELETE("/:id", requireWritePermission(permissionsRepo), handler.DeleteMovie)
+		movies.DELETE("/:id", requireDeletePermission(permissionsRepo), handler.DeleteMovie)
+		movies.GET("/:id/grants", requireWritePermission(permissionsRepo), handler.ListGrants)
+		movies.POST("/:id/grants", requireWritePermission(permissionsRepo), handler.CreateGrant)
+		movies.DELETE("/:id/grants/:user_id", requireWritePermission(permissionsRepo), handler.DeleteGrant)
+		movies.POST("/:id/credits", requireWritePermission(permissionsRepo), handler.CreateCredit)
+		movies.DELETE("/:id/credits/:credit_id", requireWritePermission(permissionsRepo), handler.DeleteCredit)
 	}
 }
 
@@ -34,6 +44,10 @@ func requireWritePermission(permissionsRepo PermissionsRepo) gin.HandlerFunc {
 	return middlewares.RequirePermission(permissionsRepo, "movies:write")
 }
 
+func requireDeletePermission(permissionsRepo PermissionsRepo) gin.HandlerFunc {
+	return middlewares.RequirePermission(permissionsRepo, "movies:write AND movies:delete")
+}
+
 func requireReadPermission(permissionsRepo PermissionsRepo) gin.HandlerFunc {
 	return middlewares.RequirePermission(permissionsRepo, "movies:read")
 }
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"greenlight/internal/people/models"
+	"greenlight/internal/repositoryerrors"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Repo interface {
+	Insert(person *models.Person) error
+	Get(id int64) (*models.Person, error)
+	GetAll(name string, filters httphelpers.Filters) ([]*models.Person, httphelpers.Metadata, error)
+	Update(person *models.Person) error
+	Delete(id int64) error
+	GetFilmography(personID int64, filters httphelpers.Filters) ([]*models.FilmographyEntry, httphelpers.Metadata, error)
+}
+
+type Handler struct {
+	Repo Repo
+}
+
+func (h *Handler) CreatePerson(c *gin.Context) {
+	var input struct {
+		Name      string `json:"name"`
+		BirthYear *int32 `json:"birth_year"`
+		Bio       string `json:"bio"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	person := &models.Person{
+		Name:      input.Name,
+		BirthYear: input.BirthYear,
+		Bio:       input.Bio,
+	}
+
+	v := validator.New()
+
+	if models.ValidatePerson(v, person); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	err = h.Repo.Insert(person)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/people/%d", person.ID))
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusCreated, gin.H{"person": person}, headers)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) ShowPerson(c *gin.Context) {
+	person, ok := h.personParam(c)
+	if !ok {
+		return
+	}
+
+	err := httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"person": person}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) ListPeople(c *gin.Context) {
+	v := validator.New()
+
+	qs := c.Request.URL.Query()
+
+	name := httphelpers.ReadString(qs, "name", "")
+
+	filters := httphelpers.Filters{
+		Page:         httphelpers.ReadInt(qs, "page", 1, v),
+		PageSize:     httphelpers.ReadInt(qs, "page_size", 20, v),
+		Sort:         httphelpers.ReadString(qs, "sort", "name"),
+		SortSafeList: []string{"id", "name", "birth_year", "-id", "-name", "-birth_year"},
+	}
+
+	if httphelpers.ValidateFilters(v, filters); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	people, metadata, err := h.Repo.GetAll(name, filters)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"people": people, "metadata": metadata}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) UpdatePerson(c *gin.Context) {
+	person, ok := h.personParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name      *string `json:"name"`
+		BirthYear *int32  `json:"birth_year"`
+		Bio       *string `json:"bio"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	if input.Name != nil {
+		person.Name = *input.Name
+	}
+	if input.BirthYear != nil {
+		person.BirthYear = input.BirthYear
+	}
+	if input.Bio != nil {
+		person.Bio = *input.Bio
+	}
+
+	v := validator.New()
+
+	if models.ValidatePerson(v, person); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	err = h.Repo.Update(person)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrEditConflict):
+			httphelpers.StatusConflictResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"person": person}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) DeletePerson(c *gin.Context) {
+	id, err := httphelpers.ReadIDParam(c)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return
+	}
+
+	err = h.Repo.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "person successfully deleted"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// ListPersonMovies lists the filmography of a person, newest movies first by default
+func (h *Handler) ListPersonMovies(c *gin.Context) {
+	person, ok := h.personParam(c)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	qs := c.Request.URL.Query()
+
+	filters := httphelpers.Filters{
+		Page:         httphelpers.ReadInt(qs, "page", 1, v),
+		PageSize:     httphelpers.ReadInt(qs, "page_size", 20, v),
+		Sort:         httphelpers.ReadString(qs, "sort", "-year"),
+		SortSafeList: []string{"year", "title", "-year", "-title"},
+	}
+
+	if httphelpers.ValidateFilters(v, filters); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	movies, metadata, err := h.Repo.GetFilmography(person.ID, filters)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"person": person, "movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) personParam(c *gin.Context) (*models.Person, bool) {
+	id, err := httphelpers.ReadIDParam(c)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return nil, false
+	}
+
+	person, err := h.Repo.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return nil, false
+	}
+
+	return person, true
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"greenlight/pkg/validator"
+)
+
+const (
+	RoleDirector = "director"
+	RoleWriter   = "writer"
+	RoleActor    = "actor"
+)
+
+var Roles = []string{RoleDirector, RoleWriter, RoleActor}
+
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	BirthYear *int32    `json:"birth_year,omitempty"`
+	Bio       string    `json:"bio,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+// Credit is the part a person had in a movie. Character is only set for actors, and lower
+// billing orders are listed first.
+type Credit struct {
+	ID           int64  `json:"id"`
+	MovieID      int64  `json:"movie_id"`
+	PersonID     int64  `json:"person_id"`
+	PersonName   string `json:"person_name"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+// FilmographyEntry is a credit of a person along with the movie it is for
+type FilmographyEntry struct {
+	MovieID      int64  `json:"movie_id"`
+	Title        string `json:"title"`
+	Year         int32  `json:"year"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	if person.BirthYear != nil {
+		v.Check(*person.BirthYear >= 1800, "birth_year", "must be greater than 1800")
+		v.Check(*person.BirthYear <= int32(time.Now().Year()), "birth_year", "must not be in the future")
+	}
+
+	v.Check(len(person.Bio) <= 10_000, "bio", "must not be more than 10000 bytes long")
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", "must be provided")
+
+	v.Check(credit.Role != "", "role", "must be provided")
+	v.Check(validator.PermittedValue(credit.Role, Roles...), "role", "must be director, writer or actor")
+
+	if credit.Role == RoleActor {
+		v.Check(credit.Character != "", "character", "must be provided for actors")
+	} else {
+		v.Check(credit.Character == "", "character", "must only be provided for actors")
+	}
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must not be negative")
+}
@@ -0,0 +1,286 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"greenlight/internal/people/models"
+	"greenlight/internal/repositoryerrors"
+	"greenlight/pkg/httphelpers"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	DB *sqlx.DB
+}
+
+func NewSqlxRepo(db *sqlx.DB) *Repo {
+	return &Repo{
+		DB: db,
+	}
+}
+
+func (r *Repo) Insert(person *models.Person) error {
+	query := `
+	INSERT INTO people (name, birth_year, bio)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return r.DB.QueryRowContext(ctx, query, person.Name, person.BirthYear, person.Bio).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (r *Repo) Get(id int64) (*models.Person, error) {
+	if id < 1 {
+		return nil, repositoryerrors.ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, name, birth_year, bio, version
+	FROM people
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var person models.Person
+
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(&person.ID, &person.CreatedAt, &person.Name, &person.BirthYear, &person.Bio, &person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, repositoryerrors.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &person, nil
+}
+
+func (r *Repo) GetAll(name string, filters httphelpers.Filters) ([]*models.Person, httphelpers.Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, name, birth_year, bio, version
+	FROM people
+	WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.SortColumn(), filters.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, name, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	people := []*models.Person{}
+
+	for rows.Next() {
+		var person models.Person
+
+		err := rows.Scan(&totalRecords, &person.ID, &person.CreatedAt, &person.Name, &person.BirthYear, &person.Bio, &person.Version)
+		if err != nil {
+			return nil, httphelpers.Metadata{}, err
+		}
+
+		people = append(people, &person)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+
+	metadata := httphelpers.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return people, metadata, nil
+}
+
+func (r *Repo) Update(person *models.Person) error {
+	query := `
+	UPDATE people
+	SET name = $1, birth_year = $2, bio = $3, version = version + 1
+	WHERE id = $4 AND version = $5
+	RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, person.Name, person.BirthYear, person.Bio, person.ID, person.Version).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return repositoryerrors.ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a person along with their credits
+func (r *Repo) Delete(id int64) error {
+	if id < 1 {
+		return repositoryerrors.ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, `DELETE FROM people WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return repositoryerrors.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetFilmography returns the credits of a person with the movies they are for
+func (r *Repo) GetFilmography(personID int64, filters httphelpers.Filters) ([]*models.FilmographyEntry, httphelpers.Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), movies.id, movies.title, movies.year, movie_credits.role, movie_credits.character, movie_credits.billing_order
+	FROM movie_credits
+	INNER JOIN movies ON movies.id = movie_credits.movie_id
+	WHERE movie_credits.person_id = $1
+	ORDER BY %s %s, movies.id ASC, movie_credits.id ASC
+	LIMIT $2 OFFSET $3`, filters.SortColumn(), filters.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, personID, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*models.FilmographyEntry{}
+
+	for rows.Next() {
+		var entry models.FilmographyEntry
+
+		err := rows.Scan(&totalRecords, &entry.MovieID, &entry.Title, &entry.Year, &entry.Role, &entry.Character, &entry.BillingOrder)
+		if err != nil {
+			return nil, httphelpers.Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+
+	metadata := httphelpers.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
+
+// GetCreditsForMovie returns the credits of a movie in billing order
+func (r *Repo) GetCreditsForMovie(movieID int64) ([]*models.Credit, error) {
+	query := `
+	SELECT movie_credits.id, movie_credits.movie_id, movie_credits.person_id, people.name,
+		movie_credits.role, movie_credits.character, movie_credits.billing_order
+	FROM movie_credits
+	INNER JOIN people ON people.id = movie_credits.person_id
+	WHERE movie_credits.movie_id = $1
+	ORDER BY movie_credits.billing_order, movie_credits.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*models.Credit{}
+
+	for rows.Next() {
+		var credit models.Credit
+
+		err := rows.Scan(&credit.ID, &credit.MovieID, &credit.PersonID, &credit.PersonName, &credit.Role, &credit.Character, &credit.BillingOrder)
+		if err != nil {
+			return nil, err
+		}
+
+		credits = append(credits, &credit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// InsertCredit credits a person in a movie. A missing person gives ErrRecordNotFound, and the
+// same credit twice ErrDuplicateCredit.
+func (r *Repo) InsertCredit(credit *models.Credit) error {
+	query := `
+	WITH inserted AS (
+		INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, person_id
+	)
+	SELECT inserted.id, people.name
+	FROM inserted
+	INNER JOIN people ON people.id = inserted.person_id`
+
+	args := []any{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&credit.ID, &credit.PersonName)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "movie_credits" violates foreign key constraint "movie_credits_person_id_fkey"`:
+			return repositoryerrors.ErrRecordNotFound
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_credits_key"`:
+			return repositoryerrors.ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Repo) DeleteCredit(movieID, id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, `DELETE FROM movie_credits WHERE movie_id = $1 AND id = $2`, movieID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return repositoryerrors.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+	"greenlight/internal/permissions/models"
+	"greenlight/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	CreatePerson(c *gin.Context)
+	ShowPerson(c *gin.Context)
+	ListPeople(c *gin.Context)
+	UpdatePerson(c *gin.Context)
+	DeletePerson(c *gin.Context)
+	ListPersonMovies(c *gin.Context)
+}
+
+type PermissionsRepo interface {
+	GetAllForUser(userID int64) (models.Permissions, error)
+}
+
+func InitRouter(engine *gin.RouterGroup, handler Handler, permissionsRepo PermissionsRepo) {
+	people := engine.Group("/people")
+	{
+		people.POST("", requireWritePermission(permissionsRepo), handler.CreatePerson)
+		people.GET("", requireReadPermission(permissionsRepo), handler.ListPeople)
+		people.GET("/:id", requireReadPermission(permissionsRepo), handler.ShowPerson)
+		people.PATCH("/:id", requireWritePermission(permissionsRepo), handler.UpdatePerson)
+		people.DELETE("/:id", requireAdminPermission(permissionsRepo), handler.DeletePerson)
+		people.GET("/:id/movies", requireReadPermission(permissionsRepo), handler.ListPersonMovies)
+	}
+}
+
+func requireWritePermission(permissionsRepo PermissionsRepo) gin.HandlerFunc {
+	return middlewares.RequirePermission(permissionsRepo, "movies:write")
+}
+
+// requireAdminPermission guards deleting people, which also deletes their credits on every movie,
+// including movies the user can't edit.
+func requireAdminPermission(permissionsRepo PermissionsRepo) gin.HandlerFunc {
+	return middlewares.RequirePermission(permissionsRepo, "movies:admin")
+}
+
+func requireReadPermission(permissionsRepo PermissionsRepo) gin.HandlerFunc {
+	return middlewares.RequirePermission(permissionsRepo, "movies:read")
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"greenlight/internal/permissions/models"
+	"greenlight/internal/repositoryerrors"
+	userModels "greenlight/internal/users/models"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Repo interface {
+	GetAll() ([]*models.Permission, error)
+	Get(code string) (*models.Permission, error)
+	Insert(permission *models.Permission) error
+	SetImplies(permission *models.Permission) error
+	GetUnknown(codes ...string) ([]string, error)
+	GetAllForUser(userID int64) (models.Permissions, error)
+	AddForUser(userID int64, codes ...string) error
+	RemoveForUser(userID int64, codes ...string) error
+}
+
+type RoleRepo interface {
+	GetAll() ([]*models.Role, error)
+	Get(name string) (*models.Role, error)
+	Insert(role *models.Role) error
+	SetPermissions(role *models.Role) error
+	Delete(name string) error
+	GetAllForUser(userID int64) ([]string, error)
+	AddForUser(userID int64, names ...string) error
+	RemoveForUser(userID int64, names ...string) error
+	GetUnknown(names ...string) ([]string, error)
+}
+
+type UserRepo interface {
+	GetByID(ctx context.Context, id int64) (*userModels.User, error)
+}
+
+type TokenService interface {
+	RevokeAccessTokens(userID int64) error
+	RevokeEveryAccessToken() error
+}
+
+// Handler manages the permission codes, the roles bundling them, and who they are granted to.
+// Signed tokens carry the permissions of their user, changes that can take permissions away cut
+// them off so they apply at once, grants show up with the next token refresh.
+type Handler struct {
+	Repo         Repo
+	RoleRepo     RoleRepo
+	UserRepo     UserRepo
+	TokenService TokenService
+	// DefaultRole is given to every new user, it can't be deleted
+	DefaultRole string
+}
+
+func (h *Handler) ListPermissions(c *gin.Context) {
+	permissions, err := h.Repo.GetAll()
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"permissions": permissions}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) CreatePermission(c *gin.Context) {
+	var input struct {
+		Code    string             `json:"code"`
+		Implies models.Permissions `json:"implies"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	if input.Implies == nil {
+		input.Implies = models.Permissions{}
+	}
+
+	permission := &models.Permission{
+		Code:    input.Code,
+		Implies: input.Implies,
+	}
+
+	v := validator.New()
+
+	if models.ValidatePermission(v, permission); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	if !h.checkKnown(c, v, "implies", "unknown permission codes: ", h.Repo.GetUnknown, permission.Implies) {
+		return
+	}
+
+	err = h.Repo.Insert(permission)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrDuplicateCode):
+			v.AddError("code", "a permission with this code already exists")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.StatusCreatedJSONPayload(c, gin.H{"permission": permission})
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// UpdatePermission replaces the codes a permission implies
+func (h *Handler) UpdatePermission(c *gin.Context) {
+	permission, err := h.Repo.Get(c.Param("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	var input struct {
+		Implies models.Permissions `json:"implies"`
+	}
+
+	err = httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	if input.Implies == nil {
+		input.Implies = models.Permissions{}
+	}
+
+	permission.Implies = input.Implies
+
+	v := validator.New()
+
+	if models.ValidateImplies(v, permission); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	if !h.checkKnown(c, v, "implies", "unknown permission codes: ", h.Repo.GetUnknown, permission.Implies) {
+		return
+	}
+
+	err = h.Repo.SetImplies(permission)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = h.TokenService.RevokeEveryAccessToken()
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"permission": permission}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) ListUserPermissions(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	h.userPermissionsResponse(c, user.ID)
+}
+
+// GrantUserPermissions grants codes to a user. Granting a code the user already has is a no-op.
+func (h *Handler) GrantUserPermissions(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	codes, ok := h.readCodes(c)
+	if !ok {
+		return
+	}
+
+	err := h.Repo.AddForUser(user.ID, codes...)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	h.userPermissionsResponse(c, user.ID)
+}
+
+// RevokeUserPermissions revokes codes granted directly to a user, codes the user gets through a
+// role are kept until the role is removed.
+func (h *Handler) RevokeUserPermissions(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	codes, ok := h.readCodes(c)
+	if !ok {
+		return
+	}
+
+	err := h.Repo.RemoveForUser(user.ID, codes...)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = h.TokenService.RevokeAccessTokens(user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	h.userPermissionsResponse(c, user.ID)
+}
+
+// readCodes decodes {"codes": [...]} and checks every code exists
+func (h *Handler) readCodes(c *gin.Context) ([]string, bool) {
+	var input struct {
+		Codes []string `json:"codes"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return nil, false
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Codes) > 0, "codes", "must contain at least 1 code")
+	v.Check(validator.Unique(input.Codes), "codes", "must not contain duplicate values")
+
+	if !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return nil, false
+	}
+
+	if !h.checkKnown(c, v, "codes", "unknown permission codes: ", h.Repo.GetUnknown, input.Codes) {
+		return nil, false
+	}
+
+	return input.Codes, true
+}
+
+// checkKnown responds with the values getUnknown reports missing, and returns whether there
+// were none.
+func (h *Handler) checkKnown(c *gin.Context, v *validator.Validator, key, message string, getUnknown func(...string) ([]string, error), values []string) bool {
+	unknown, err := getUnknown(values...)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return false
+	}
+
+	if len(unknown) > 0 {
+		v.AddError(key, message+strings.Join(unknown, ", "))
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) userPermissionsResponse(c *gin.Context, userID int64) {
+	permissions, err := h.Repo.GetAllForUser(userID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	if permissions == nil {
+		permissions = models.Permissions{}
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"permissions": permissions}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) userParam(c *gin.Context) (*userModels.User, bool) {
+	id, err := httphelpers.ReadIDParam(c)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return nil, false
+	}
+
+	user, err := h.UserRepo.GetByID(c, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"greenlight/internal/permissions/models"
+	"greenlight/internal/repositoryerrors"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) ListRoles(c *gin.Context) {
+	roles, err := h.RoleRepo.GetAll()
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"roles": roles}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) CreateRole(c *gin.Context) {
+	var input struct {
+		Name        string             `json:"name"`
+		Permissions models.Permissions `json:"permissions"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	role := &models.Role{
+		Name:        input.Name,
+		Permissions: input.Permissions,
+	}
+
+	v := validator.New()
+
+	if models.ValidateRole(v, role); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	if !h.checkKnown(c, v, "permissions", "unknown permission codes: ", h.Repo.GetUnknown, role.Permissions) {
+		return
+	}
+
+	err = h.RoleRepo.Insert(role)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrDuplicateName):
+			v.AddError("name", "a role with this name already exists")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.StatusCreatedJSONPayload(c, gin.H{"role": role})
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// UpdateRole replaces the permissions of a role, which changes them for every user with the role
+func (h *Handler) UpdateRole(c *gin.Context) {
+	role, ok := h.roleParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Permissions models.Permissions `json:"permissions"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	role.Permissions = input.Permissions
+
+	v := validator.New()
+
+	if models.ValidateRolePermissions(v, role.Permissions); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	if !h.checkKnown(c, v, "permissions", "unknown permission codes: ", h.Repo.GetUnknown, role.Permissions) {
+		return
+	}
+
+	err = h.RoleRepo.SetPermissions(role)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = h.TokenService.RevokeEveryAccessToken()
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"role": role}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) DeleteRole(c *gin.Context) {
+	if c.Param("name") == h.DefaultRole {
+		httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusConflict, gin.H{"error": "the default role of new users can't be deleted"}, nil)
+		return
+	}
+
+	err := h.RoleRepo.Delete(c.Param("name"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = h.TokenService.RevokeEveryAccessToken()
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "role successfully deleted"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) ListUserRoles(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	h.userRolesResponse(c, user.ID)
+}
+
+// AssignUserRoles gives roles to a user. Assigning a role the user already has is a no-op.
+func (h *Handler) AssignUserRoles(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	roles, ok := h.readRoles(c)
+	if !ok {
+		return
+	}
+
+	err := h.RoleRepo.AddForUser(user.ID, roles...)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	h.userRolesResponse(c, user.ID)
+}
+
+func (h *Handler) UnassignUserRoles(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	roles, ok := h.readRoles(c)
+	if !ok {
+		return
+	}
+
+	err := h.RoleRepo.RemoveForUser(user.ID, roles...)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = h.TokenService.RevokeAccessTokens(user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	h.userRolesResponse(c, user.ID)
+}
+
+// readRoles decodes {"roles": [...]} and checks every role exists
+func (h *Handler) readRoles(c *gin.Context) ([]string, bool) {
+	var input struct {
+		Roles []string `json:"roles"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return nil, false
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Roles) > 0, "roles", "must contain at least 1 role")
+	v.Check(validator.Unique(input.Roles), "roles", "must not contain duplicate values")
+
+	if !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return nil, false
+	}
+
+	if !h.checkKnown(c, v, "roles", "unknown roles: ", h.RoleRepo.GetUnknown, input.Roles) {
+		return nil, false
+	}
+
+	return input.Roles, true
+}
+
+// userRolesResponse responds with the roles of a user and the permissions they end up with
+func (h *Handler) userRolesResponse(c *gin.Context, userID int64) {
+	roles, err := h.RoleRepo.GetAllForUser(userID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	permissions, err := h.Repo.GetAllForUser(userID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	if permissions == nil {
+		permissions = models.Permissions{}
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"roles": roles, "permissions": permissions}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) roleParam(c *gin.Context) (*models.Role, bool) {
+	role, err := h.RoleRepo.Get(c.Param("name"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return nil, false
+	}
+
+	return role, true
+}
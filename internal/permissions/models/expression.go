@@ -0,0 +1,182 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Expression is a permission requirement such as "movies:write AND movies:delete". Codes can be
+// combined with AND and OR, where AND binds tighter, and grouped with parentheses.
+type Expression interface {
+	// Allows reports whether permissions satisfy the expression
+	Allows(permissions Permissions) bool
+	String() string
+}
+
+var ErrInvalidExpression = errors.New("invalid permission expression")
+
+type codeExpression string
+
+func (e codeExpression) Allows(permissions Permissions) bool {
+	return permissions.Include(string(e))
+}
+
+func (e codeExpression) String() string {
+	return string(e)
+}
+
+type andExpression []Expression
+
+func (e andExpression) Allows(permissions Permissions) bool {
+	for _, operand := range e {
+		if !operand.Allows(permissions) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e andExpression) String() string {
+	return join(e, " AND ")
+}
+
+type orExpression []Expression
+
+func (e orExpression) Allows(permissions Permissions) bool {
+	for _, operand := range e {
+		if operand.Allows(permissions) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e orExpression) String() string {
+	return join(e, " OR ")
+}
+
+func join(operands []Expression, separator string) string {
+	parts := make([]string, len(operands))
+	for i, operand := range operands {
+		parts[i] = operand.String()
+		if _, ok := operand.(codeExpression); !ok {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, separator)
+}
+
+// ParseExpression parses a permission expression. A single code is an expression too.
+func ParseExpression(s string) (Expression, error) {
+	p := &expressionParser{tokens: tokenize(s)}
+
+	expression, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidExpression, p.tokens[p.pos])
+	}
+
+	return expression, nil
+}
+
+// MustParseExpression is like ParseExpression but panics if s is invalid, for expressions
+// fixed when the routes are set up.
+func MustParseExpression(s string) Expression {
+	expression, err := ParseExpression(s)
+	if err != nil {
+		panic(err)
+	}
+	return expression
+}
+
+func tokenize(s string) []string {
+	return strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(s))
+}
+
+type expressionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *expressionParser) next() string {
+	if p.pos == len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *expressionParser) parseOr() (Expression, error) {
+	var operands orExpression
+
+	for {
+		operand, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+
+		if p.next() != "OR" {
+			break
+		}
+		p.pos++
+	}
+
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return operands, nil
+}
+
+func (p *expressionParser) parseAnd() (Expression, error) {
+	var operands andExpression
+
+	for {
+		operand, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+
+		if p.next() != "AND" {
+			break
+		}
+		p.pos++
+	}
+
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return operands, nil
+}
+
+func (p *expressionParser) parseOperand() (Expression, error) {
+	token := p.next()
+
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("%w: unexpected end", ErrInvalidExpression)
+	case token == "(":
+		p.pos++
+
+		expression, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next() != ")" {
+			return nil, fmt.Errorf("%w: missing )", ErrInvalidExpression)
+		}
+		p.pos++
+
+		return expression, nil
+	case CodeRX.MatchString(token):
+		p.pos++
+		return codeExpression(token), nil
+	default:
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidExpression, token)
+	}
+}
@@ -1,12 +1,71 @@
 package models
 
+import (
+	"regexp"
+	"strings"
+
+	"greenlight/pkg/validator"
+)
+
+// CodeRX matches permission codes such as "movies:read", a resource and an action. Any part can
+// be the "*" wildcard, as in "movies:*" or "*:read".
+var CodeRX = regexp.MustCompile(`^([a-z0-9_-]+|\*)(:([a-z0-9_-]+|\*))+$`)
+
+// Permission is a permission code, and the codes anyone granted it gets as well
+type Permission struct {
+	ID      int64       `json:"id"`
+	Code    string      `json:"code"`
+	Implies Permissions `json:"implies"`
+}
+
 type Permissions []string
 
+// Include reports whether any of the permissions is or matches code. A "*" part of a permission
+// matches any one part of code, and a trailing one matches all of its remaining parts, so
+// "admin:*" includes "admin:users:delete" and "*:*" includes every code. Wildcards in code itself
+// are taken literally, so "movies:read" doesn't include "movies:*".
 func (p Permissions) Include(code string) bool {
 	for i := range p {
-		if code == p[i] {
+		if code == p[i] || matches(p[i], code) {
 			return true
 		}
 	}
 	return false
 }
+
+func matches(pattern, code string) bool {
+	patternParts := strings.Split(pattern, ":")
+	codeParts := strings.Split(code, ":")
+
+	for i, part := range patternParts {
+		if i >= len(codeParts) {
+			return false
+		}
+
+		if part == "*" && i == len(patternParts)-1 {
+			return true
+		}
+
+		if part != "*" && part != codeParts[i] {
+			return false
+		}
+	}
+
+	return len(patternParts) == len(codeParts)
+}
+
+func ValidatePermission(v *validator.Validator, permission *Permission) {
+	ValidateCode(v, permission.Code)
+	ValidateImplies(v, permission)
+}
+
+func ValidateImplies(v *validator.Validator, permission *Permission) {
+	v.Check(validator.Unique(permission.Implies), "implies", "must not contain duplicate values")
+	v.Check(!validator.PermittedValue(permission.Code, permission.Implies...), "implies", "must not contain the code itself")
+}
+
+func ValidateCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) <= 100, "code", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(code, CodeRX), "code", "must look like resource:action, in lowercase")
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"regexp"
+
+	"greenlight/pkg/validator"
+)
+
+var RoleNameRX = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Role is a named bundle of permission codes, users get all the codes of their roles on top of
+// the ones granted to them directly.
+type Role struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Permissions Permissions `json:"permissions"`
+}
+
+func ValidateRoleName(v *validator.Validator, name string) {
+	v.Check(name != "", "name", "must be provided")
+	v.Check(len(name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(name, RoleNameRX), "name", "must only contain lowercase letters, digits, dashes and underscores")
+}
+
+func ValidateRolePermissions(v *validator.Validator, permissions Permissions) {
+	v.Check(permissions != nil, "permissions", "must be provided")
+	v.Check(validator.Unique(permissions), "permissions", "must not contain duplicate values")
+}
+
+func ValidateRole(v *validator.Validator, role *Role) {
+	ValidateRoleName(v, role.Name)
+	ValidateRolePermissions(v, role.Permissions)
+}
@@ -0,0 +1,240 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"greenlight/internal/permissions/models"
+	"greenlight/internal/repositoryerrors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type RoleRepo struct {
+	DB *sqlx.DB
+}
+
+func NewRoleSqlxRepo(db *sqlx.DB) *RoleRepo {
+	return &RoleRepo{
+		DB: db,
+	}
+}
+
+func (r *RoleRepo) GetAll() ([]*models.Role, error) {
+	query := `
+		SELECT roles.id, roles.name, array_remove(array_agg(permissions.code ORDER BY permissions.code), NULL)
+		FROM roles
+		LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+		LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id
+		GROUP BY roles.id
+		ORDER BY roles.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*models.Role{}
+
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name, pq.Array(&role.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *RoleRepo) Get(name string) (*models.Role, error) {
+	query := `
+		SELECT roles.id, roles.name, array_remove(array_agg(permissions.code ORDER BY permissions.code), NULL)
+		FROM roles
+		LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+		LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id
+		WHERE roles.name = $1
+		GROUP BY roles.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role models.Role
+
+	err := r.DB.QueryRowContext(ctx, query, name).Scan(&role.ID, &role.Name, pq.Array(&role.Permissions))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, repositoryerrors.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &role, nil
+}
+
+// Insert creates a role with its permissions. Unknown codes are ignored, see Repo.GetUnknown.
+func (r *RoleRepo) Insert(role *models.Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO roles (name) VALUES ($1) RETURNING id`, role.Name).Scan(&role.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "roles_name_key"`:
+			return repositoryerrors.ErrDuplicateName
+		default:
+			return err
+		}
+	}
+
+	err = addRolePermissions(ctx, tx, role.ID, role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetPermissions replaces the permissions of a role
+func (r *RoleRepo) SetPermissions(role *models.Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM roles_permissions WHERE role_id = $1`, role.ID)
+	if err != nil {
+		return err
+	}
+
+	err = addRolePermissions(ctx, tx, role.ID, role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func addRolePermissions(ctx context.Context, tx *sqlx.Tx, roleID int64, codes models.Permissions) error {
+	query := `
+		INSERT INTO roles_permissions
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+
+	_, err := tx.ExecContext(ctx, query, roleID, pq.Array(codes))
+	return err
+}
+
+func (r *RoleRepo) Delete(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, `DELETE FROM roles WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return repositoryerrors.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForUser returns the names of the roles of a user
+func (r *RoleRepo) GetAllForUser(userID int64) ([]string, error) {
+	query := `
+		SELECT roles.name
+		FROM roles
+		INNER JOIN users_roles ON users_roles.role_id = roles.id
+		WHERE users_roles.user_id = $1
+		ORDER BY roles.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	roles := []string{}
+
+	err := r.DB.SelectContext(ctx, &roles, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// AddForUser gives roles to a user. Roles the user already has are skipped, and unknown names
+// are ignored, see GetUnknown.
+func (r *RoleRepo) AddForUser(userID int64, names ...string) error {
+	query := `
+		INSERT INTO users_roles
+		SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, userID, pq.Array(names))
+	return err
+}
+
+func (r *RoleRepo) RemoveForUser(userID int64, names ...string) error {
+	query := `
+		DELETE FROM users_roles
+		USING roles
+		WHERE users_roles.role_id = roles.id
+		AND users_roles.user_id = $1
+		AND roles.name = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, userID, pq.Array(names))
+	return err
+}
+
+// GetUnknown returns the names missing from the roles table
+func (r *RoleRepo) GetUnknown(names ...string) ([]string, error) {
+	query := `
+		SELECT requested.name
+		FROM unnest($1::text[]) AS requested(name)
+		WHERE NOT EXISTS (SELECT 1 FROM roles WHERE roles.name = requested.name)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var unknown []string
+
+	err := r.DB.SelectContext(ctx, &unknown, query, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+
+	return unknown, nil
+}
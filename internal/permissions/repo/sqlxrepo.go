@@ -2,9 +2,12 @@ package repo
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
 	"greenlight/internal/permissions/models"
+	"greenlight/internal/repositoryerrors"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
@@ -20,13 +23,28 @@ func NewSqlxRepo(db *sqlx.DB) *Repo {
 	}
 }
 
+// GetAllForUser returns the codes granted to a user, directly or through one of their roles,
+// along with every code those imply, however indirectly.
 func (r *Repo) GetAllForUser(userID int64) (models.Permissions, error) {
 	query := `
+		WITH RECURSIVE granted (permission_id) AS (
+			SELECT users_permissions.permission_id
+			FROM users_permissions
+			WHERE users_permissions.user_id = $1
+			UNION
+			SELECT roles_permissions.permission_id
+			FROM roles_permissions
+			INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+			WHERE users_roles.user_id = $1
+			UNION
+			SELECT permissions_implications.implied_permission_id
+			FROM permissions_implications
+			INNER JOIN granted ON granted.permission_id = permissions_implications.permission_id
+		)
 		SELECT permissions.code
 		FROM permissions
-		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-		INNER JOIN users ON users_permissions.user_id = users.id
-		WHERE users.id = $1`
+		INNER JOIN granted ON granted.permission_id = permissions.id
+		ORDER BY permissions.code`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -53,10 +71,28 @@ func (r *Repo) GetAllForUser(userID int64) (models.Permissions, error) {
 	return permissions, nil
 }
 
+// AddForUser grants codes to a user. Codes the user already has are skipped, and unknown codes
+// are ignored, see GetUnknown.
 func (r *Repo) AddForUser(userID int64, codes ...string) error {
 	query := `
 		INSERT INTO users_permissions
-		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+func (r *Repo) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+		DELETE FROM users_permissions
+		USING permissions
+		WHERE users_permissions.permission_id = permissions.id
+		AND users_permissions.user_id = $1
+		AND permissions.code = ANY($2)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -64,3 +100,147 @@ func (r *Repo) AddForUser(userID int64, codes ...string) error {
 	_, err := r.DB.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
+
+func (r *Repo) GetAll() ([]*models.Permission, error) {
+	query := `
+		SELECT permissions.id, permissions.code, array_remove(array_agg(implied.code ORDER BY implied.code), NULL)
+		FROM permissions
+		LEFT JOIN permissions_implications ON permissions_implications.permission_id = permissions.id
+		LEFT JOIN permissions implied ON implied.id = permissions_implications.implied_permission_id
+		GROUP BY permissions.id
+		ORDER BY permissions.code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*models.Permission{}
+
+	for rows.Next() {
+		var permission models.Permission
+		if err := rows.Scan(&permission.ID, &permission.Code, pq.Array(&permission.Implies)); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, &permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (r *Repo) Get(code string) (*models.Permission, error) {
+	query := `
+		SELECT permissions.id, permissions.code, array_remove(array_agg(implied.code ORDER BY implied.code), NULL)
+		FROM permissions
+		LEFT JOIN permissions_implications ON permissions_implications.permission_id = permissions.id
+		LEFT JOIN permissions implied ON implied.id = permissions_implications.implied_permission_id
+		WHERE permissions.code = $1
+		GROUP BY permissions.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var permission models.Permission
+
+	err := r.DB.QueryRowContext(ctx, query, code).Scan(&permission.ID, &permission.Code, pq.Array(&permission.Implies))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, repositoryerrors.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &permission, nil
+}
+
+// Insert creates a permission along with the codes it implies. Unknown implied codes are
+// ignored, see GetUnknown.
+func (r *Repo) Insert(permission *models.Permission) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO permissions (code) VALUES ($1) RETURNING id`, permission.Code).Scan(&permission.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "permissions_code_key"`:
+			return repositoryerrors.ErrDuplicateCode
+		default:
+			return err
+		}
+	}
+
+	err = addImplications(ctx, tx, permission.ID, permission.Implies)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetImplies replaces the codes a permission implies
+func (r *Repo) SetImplies(permission *models.Permission) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM permissions_implications WHERE permission_id = $1`, permission.ID)
+	if err != nil {
+		return err
+	}
+
+	err = addImplications(ctx, tx, permission.ID, permission.Implies)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func addImplications(ctx context.Context, tx *sqlx.Tx, permissionID int64, codes models.Permissions) error {
+	query := `
+		INSERT INTO permissions_implications
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+
+	_, err := tx.ExecContext(ctx, query, permissionID, pq.Array(codes))
+	return err
+}
+
+// GetUnknown returns the codes missing from the permissions table
+func (r *Repo) GetUnknown(codes ...string) ([]string, error) {
+	query := `
+		SELECT requested.code
+		FROM unnest($1::text[]) AS requested(code)
+		WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE permissions.code = requested.code)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var unknown []string
+
+	err := r.DB.SelectContext(ctx, &unknown, query, pq.Array(codes))
+	if err != nil {
+		return nil, err
+	}
+
+	return unknown, nil
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+	"greenlight/internal/permissions/models"
+	"greenlight/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	ListPermissions(c *gin.Context)
+	CreatePermission(c *gin.Context)
+	UpdatePermission(c *gin.Context)
+	ListUserPermissions(c *gin.Context)
+	GrantUserPermissions(c *gin.Context)
+	RevokeUserPermissions(c *gin.Context)
+	ListRoles(c *gin.Context)
+	CreateRole(c *gin.Context)
+	UpdateRole(c *gin.Context)
+	DeleteRole(c *gin.Context)
+	ListUserRoles(c *gin.Context)
+	AssignUserRoles(c *gin.Context)
+	UnassignUserRoles(c *gin.Context)
+}
+
+type PermissionsRepo interface {
+	GetAllForUser(userID int64) (models.Permissions, error)
+}
+
+func InitRouter(engine *gin.RouterGroup, handler Handler, permissionsRepo PermissionsRepo) {
+	admin := engine.Group("/admin", middlewares.RequirePermission(permissionsRepo, "users:admin"))
+	{
+		admin.GET("/permissions", handler.ListPermissions)
+		admin.POST("/permissions", handler.CreatePermission)
+		admin.PATCH("/permissions/:code", handler.UpdatePermission)
+		admin.GET("/users/:id/permissions", handler.ListUserPermissions)
+		admin.POST("/users/:id/permissions", handler.GrantUserPermissions)
+		admin.DELETE("/users/:id/permissions", handler.RevokeUserPermissions)
+		admin.GET("/roles", handler.ListRoles)
+		admin.POST("/roles", handler.CreateRole)
+		admin.PATCH("/roles/:name", handler.UpdateRole)
+		admin.DELETE("/roles/:name", handler.DeleteRole)
+		admin.GET("/users/:id/roles", handler.ListUserRoles)
+		admin.POST("/users/:id/roles", handler.AssignUserRoles)
+		admin.DELETE("/users/:id/roles", handler.UnassignUserRoles)
+	}
+}
@@ -3,7 +3,13 @@ package repositoryerrors
 import "errors"
 
 var (
-	ErrRecordNotFound = errors.New("record not found")
-	ErrEditConflict   = errors.New("edit conflict")
-	ErrDuplicateEmail = errors.New("duplicate email")
+	ErrRecordNotFound  = errors.New("record not found")
+	ErrEditConflict    = errors.New("edit conflict")
+	ErrDuplicateEmail  = errors.New("duplicate email")
+	ErrDuplicateCode   = errors.New("duplicate code")
+	ErrDuplicateName   = errors.New("duplicate name")
+	ErrDuplicateReview = errors.New("duplicate review")
+	ErrDuplicateCredit = errors.New("duplicate credit")
+	ErrDuplicateSlug   = errors.New("duplicate slug")
+	ErrRecordInUse     = errors.New("record in use")
 )
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	movieModels "greenlight/internal/movies/models"
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/reviews/models"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Repo interface {
+	Insert(review *models.Review) error
+	Get(movieID, id int64) (*models.Review, error)
+	GetAllForMovie(movieID int64, filters httphelpers.Filters) ([]*models.Review, httphelpers.Metadata, error)
+	Update(review *models.Review) error
+	Delete(movieID, id int64) error
+}
+
+type MovieRepo interface {
+	Get(id int64) (*movieModels.Movie, error)
+}
+
+// Handler serves the reviews of a movie. Every user can review a movie once, and only change or
+// delete their own review.
+type Handler struct {
+	Repo      Repo
+	MovieRepo MovieRepo
+}
+
+func (h *Handler) ListReviews(c *gin.Context) {
+	movie, ok := h.movieParam(c)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	qs := c.Request.URL.Query()
+
+	filters := httphelpers.Filters{
+		Page:         httphelpers.ReadInt(qs, "page", 1, v),
+		PageSize:     httphelpers.ReadInt(qs, "page_size", 20, v),
+		Sort:         httphelpers.ReadString(qs, "sort", "-created_at"),
+		SortSafeList: []string{"id", "rating", "created_at", "-id", "-rating", "-created_at"},
+	}
+
+	if httphelpers.ValidateFilters(v, filters); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	reviews, metadata, err := h.Repo.GetAllForMovie(movie.ID, filters)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"reviews": reviews, "metadata": metadata}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) CreateReview(c *gin.Context) {
+	movie, ok := h.movieParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Rating int32  `json:"rating"`
+		Body   string `json:"body"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	user := httphelpers.ContextGetUser(c)
+
+	review := &models.Review{
+		MovieID: movie.ID,
+		UserID:  &user.ID,
+		Rating:  input.Rating,
+		Body:    input.Body,
+	}
+
+	v := validator.New()
+
+	if models.ValidateReview(v, review); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	err = h.Repo.Insert(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrDuplicateReview):
+			v.AddError("movie", "you have already reviewed this movie")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d/reviews/%d", movie.ID, review.ID))
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusCreated, gin.H{"review": review}, headers)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) ShowReview(c *gin.Context) {
+	review, ok := h.reviewParam(c)
+	if !ok {
+		return
+	}
+
+	err := httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"review": review}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) UpdateReview(c *gin.Context) {
+	review, ok := h.reviewParam(c)
+	if !ok {
+		return
+	}
+
+	if !h.requireAuthor(c, review) {
+		return
+	}
+
+	var input struct {
+		Rating *int32  `json:"rating"`
+		Body   *string `json:"body"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	if input.Rating != nil {
+		review.Rating = *input.Rating
+	}
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+
+	v := validator.New()
+
+	if models.ValidateReview(v, review); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	err = h.Repo.Update(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrEditConflict):
+			httphelpers.StatusConflictResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"review": review}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) DeleteReview(c *gin.Context) {
+	review, ok := h.reviewParam(c)
+	if !ok {
+		return
+	}
+
+	if !h.requireAuthor(c, review) {
+		return
+	}
+
+	err := h.Repo.Delete(review.MovieID, review.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "review successfully deleted"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) requireAuthor(c *gin.Context, review *models.Review) bool {
+	user := httphelpers.ContextGetUser(c)
+
+	if review.UserID == nil || *review.UserID != user.ID {
+		httphelpers.StatusForbiddenResponse(c)
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) movieParam(c *gin.Context) (*movieModels.Movie, bool) {
+	id, err := httphelpers.ReadIDParam(c)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return nil, false
+	}
+
+	movie, err := h.MovieRepo.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return nil, false
+	}
+
+	return movie, true
+}
+
+func (h *Handler) reviewParam(c *gin.Context) (*models.Review, bool) {
+	movieID, err := httphelpers.ReadIDParam(c)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return nil, false
+	}
+
+	id, err := strconv.ParseInt(c.Param("review_id"), 10, 64)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return nil, false
+	}
+
+	review, err := h.Repo.Get(movieID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return nil, false
+	}
+
+	return review, true
+}
@@ -0,0 +1,258 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/reviews/models"
+	"greenlight/pkg/httphelpers"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Repo stores reviews. Every change also updates the rating aggregates of the movie, in the same
+// transaction, so they stay right under concurrent reviews.
+type Repo struct {
+	DB *sqlx.DB
+}
+
+func NewSqlxRepo(db *sqlx.DB) *Repo {
+	return &Repo{
+		DB: db,
+	}
+}
+
+// Insert adds a review and counts it in the movie rating. A second review of the same movie by
+// the same user gives ErrDuplicateReview, and a missing movie ErrRecordNotFound.
+func (r *Repo) Insert(review *models.Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateRating(ctx, tx, review.MovieID, review.Rating, 1)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO reviews (movie_id, user_id, rating, body)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at, version`
+
+	err = tx.QueryRowContext(ctx, query, review.MovieID, review.UserID, review.Rating, review.Body).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_movie_id_user_id_key"`:
+			return repositoryerrors.ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repo) Get(movieID, id int64) (*models.Review, error) {
+	if id < 1 {
+		return nil, repositoryerrors.ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, movie_id, user_id, rating, body, created_at, updated_at, version
+	FROM reviews
+	WHERE movie_id = $1 AND id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var review models.Review
+
+	err := scanReview(r.DB.QueryRowContext(ctx, query, movieID, id), &review)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, repositoryerrors.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+func (r *Repo) GetAllForMovie(movieID int64, filters httphelpers.Filters) ([]*models.Review, httphelpers.Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, movie_id, user_id, rating, body, created_at, updated_at, version
+	FROM reviews
+	WHERE movie_id = $1
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.SortColumn(), filters.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, movieID, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*models.Review{}
+
+	for rows.Next() {
+		var review models.Review
+
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.MovieID,
+			&review.UserID,
+			&review.Rating,
+			&review.Body,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, httphelpers.Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+
+	metadata := httphelpers.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+// Update saves the rating and body of a review, unless it changed since it was read, which
+// gives ErrEditConflict.
+func (r *Repo) Update(review *models.Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previousRating int32
+
+	err = tx.QueryRowContext(ctx, `SELECT rating FROM reviews WHERE id = $1 AND version = $2 FOR UPDATE`, review.ID, review.Version).Scan(&previousRating)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return repositoryerrors.ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query := `
+	UPDATE reviews
+	SET rating = $1, body = $2, updated_at = NOW(), version = version + 1
+	WHERE id = $3
+	RETURNING updated_at, version`
+
+	err = tx.QueryRowContext(ctx, query, review.Rating, review.Body, review.ID).Scan(&review.UpdatedAt, &review.Version)
+	if err != nil {
+		return err
+	}
+
+	err = updateRating(ctx, tx, review.MovieID, review.Rating-previousRating, 0)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a review and takes it out of the movie rating
+func (r *Repo) Delete(movieID, id int64) error {
+	if id < 1 {
+		return repositoryerrors.ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var rating int32
+
+	err = tx.QueryRowContext(ctx, `DELETE FROM reviews WHERE movie_id = $1 AND id = $2 RETURNING rating`, movieID, id).Scan(&rating)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return repositoryerrors.ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = updateRating(ctx, tx, movieID, -rating, -1)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateRating adds ratingDelta to the rating total of a movie and countDelta to its number of
+// ratings, then recomputes the average. The expressions use the row as locked by the update, so
+// concurrent changes to the same movie add up.
+func updateRating(ctx context.Context, tx *sqlx.Tx, movieID int64, ratingDelta, countDelta int32) error {
+	query := `
+	UPDATE movies
+	SET rating_total = rating_total + $2,
+		rating_count = rating_count + $3,
+		rating = COALESCE(round((rating_total + $2)::numeric / NULLIF(rating_count + $3, 0), 2), 0)
+	WHERE id = $1`
+
+	result, err := tx.ExecContext(ctx, query, movieID, ratingDelta, countDelta)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return repositoryerrors.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func scanReview(row interface{ Scan(...any) error }, review *models.Review) error {
+	return row.Scan(
+		&review.ID,
+		&review.MovieID,
+		&review.UserID,
+		&review.Rating,
+		&review.Body,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.Version,
+	)
+}
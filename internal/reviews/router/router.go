@@ -0,0 +1,34 @@
+package router
+
+import (
+	"greenlight/internal/permissions/models"
+	"greenlight/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	ListReviews(c *gin.Context)
+	CreateReview(c *gin.Context)
+	ShowReview(c *gin.Context)
+	UpdateReview(c *gin.Context)
+	DeleteReview(c *gin.Context)
+}
+
+type PermissionsRepo interface {
+	GetAllForUser(userID int64) (models.Permissions, error)
+}
+
+func InitRouter(engine *gin.RouterGroup, handler Handler, permissionsRepo PermissionsRepo) {
+	// Any reader can review movies, API keys need a write scope to.
+	writeScope := middlewares.RequireScope("movies:write")
+
+	reviews := engine.Group("/movies/:id/reviews", middlewares.RequirePermission(permissionsRepo, "movies:read"))
+	{
+		reviews.GET("", handler.ListReviews)
+		reviews.POST("", writeScope, handler.CreateReview)
+		reviews.GET("/:review_id", handler.ShowReview)
+		reviews.PATCH("/:review_id", writeScope, handler.UpdateReview)
+		reviews.DELETE("/:review_id", writeScope, handler.DeleteReview)
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyRepo interface {
+	DeleteAllForUser(userID int64) error
+}
+
+type AdminHandler struct {
+	UserRepo     UserRepo
+	UserService  UserService
+	TokenService TokenService
+	APIKeyRepo   APIKeyRepo
+	LoginGuard   LoginGuard
+}
+
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	v := validator.New()
+
+	qs := c.Request.URL.Query()
+
+	search := httphelpers.ReadString(qs, "search", "")
+	activated := httphelpers.ReadBool(qs, "activated", v)
+	suspended := httphelpers.ReadBool(qs, "suspended", v)
+
+	filters := httphelpers.Filters{
+		Page:         httphelpers.ReadInt(qs, "page", 1, v),
+		PageSize:     httphelpers.ReadInt(qs, "page_size", 20, v),
+		Sort:         httphelpers.ReadString(qs, "sort", "id"),
+		SortSafeList: []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"},
+	}
+
+	if httphelpers.ValidateFilters(v, filters); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	users, metadata, err := h.UserRepo.GetAll(c, search, activated, suspended, filters)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"users": users, "metadata": metadata}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *AdminHandler) ShowUser(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	err := httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"user": user}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// UpdateUser activates, deactivates, suspends or reinstates an account. Suspending also revokes
+// every token of the user, deactivating cuts off their signed access tokens, whose claims still
+// say the account is activated.
+func (h *AdminHandler) UpdateUser(c *gin.Context) {
+	var input struct {
+		Activated *bool `json:"activated"`
+		Suspended *bool `json:"suspended"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	// Admins locking themselves out could leave nobody to undo it.
+	if user.ID == httphelpers.ContextGetUser(c).ID {
+		v.Check(input.Activated == nil || *input.Activated, "activated", "you cannot deactivate your own account")
+		v.Check(input.Suspended == nil || !*input.Suspended, "suspended", "you cannot suspend your own account")
+	}
+
+	if !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	suspending := input.Suspended != nil && *input.Suspended && !user.Suspended
+	deactivating := input.Activated != nil && !*input.Activated && user.Activated
+
+	if input.Activated != nil {
+		user.Activated = *input.Activated
+	}
+
+	if input.Suspended != nil {
+		user.Suspended = *input.Suspended
+	}
+
+	err = h.UserRepo.Update(c, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrEditConflict):
+			httphelpers.StatusConflictResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	switch {
+	case suspending:
+		err = h.TokenService.RevokeAllAuthenticationTokens(user.ID)
+	case deactivating:
+		err = h.TokenService.RevokeAccessTokens(user.ID)
+	}
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"user": user}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *AdminHandler) ResetUserPassword(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	err := h.UserService.ForcePasswordReset(c, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrEditConflict):
+			httphelpers.StatusConflictResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusAccepted, gin.H{"message": "the password was reset and the user will receive instructions to choose a new one"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// RevokeUserTokens signs a user out of every session and deletes their API keys
+func (h *AdminHandler) RevokeUserTokens(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	err := h.APIKeyRepo.DeleteAllForUser(user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = h.TokenService.RevokeAllAuthenticationTokens(user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "all tokens successfully revoked"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *AdminHandler) ClearLockout(c *gin.Context) {
+	user, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+
+	err := h.LoginGuard.Clear(user)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	httphelpers.StatusNoContentResponse(c)
+}
+
+// userParam loads the user named by the id route parameter, responding 404 when there is none
+func (h *AdminHandler) userParam(c *gin.Context) (*models.User, bool) {
+	id, err := httphelpers.ReadIDParam(c)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return nil, false
+	}
+
+	user, err := h.UserRepo.GetByID(c, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MFAService interface {
+	Enroll(user *models.User) (*models.TOTPEnrollment, error)
+	Confirm(userID int64, code string) ([]string, bool, error)
+	Enabled(userID int64) (bool, error)
+	Verify(userID int64, code string) (bool, error)
+	Disable(userID int64, code string) (bool, error)
+}
+
+type MFAHandler struct {
+	UserRepo   UserRepo
+	MFAService MFAService
+}
+
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	user, err := h.UserRepo.GetByID(c, httphelpers.ContextGetUser(c).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusUnauthorizedResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	enrollment, err := h.MFAService.Enroll(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTOTPAlreadyEnabled):
+			httphelpers.StatusBadRequestResponse(c, "two-factor authentication is already enabled")
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusCreated, gin.H{"totp": enrollment}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+type totpCodeInput struct {
+	Code string `json:"code"`
+}
+
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	var input totpCodeInput
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	if models.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	codes, ok, err := h.MFAService.Confirm(httphelpers.ContextGetUser(c).ID, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTOTPNotEnrolled):
+			httphelpers.StatusBadRequestResponse(c, "two-factor authentication has not been enrolled")
+		case errors.Is(err, models.ErrTOTPAlreadyEnabled):
+			httphelpers.StatusBadRequestResponse(c, "two-factor authentication is already enabled")
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	if !ok {
+		v.AddError("code", "is invalid")
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"recovery_codes": codes}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	var input totpCodeInput
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.Code != "", "code", "must be provided"); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	ok, err := h.MFAService.Disable(httphelpers.ContextGetUser(c).ID, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTOTPNotEnrolled):
+			httphelpers.StatusBadRequestResponse(c, "two-factor authentication is not enabled")
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	if !ok {
+		v.AddError("code", "is invalid")
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "two-factor authentication successfully disabled"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
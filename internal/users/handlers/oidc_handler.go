@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/oidc"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OIDCService interface {
+	BeginLogin() (string, error)
+	CompleteLogin(ctx context.Context, state, code string) (*models.User, error)
+}
+
+// OIDCHandler signs users in through the configured identity provider. Without one, OIDCService
+// is nil and its routes respond 404.
+type OIDCHandler struct {
+	OIDCService  OIDCService
+	TokenRepo    TokenRepo
+	TokenService TokenService
+	MFAService   MFAService
+	// SecureCookies marks session cookies Secure, see TokenHandler
+	SecureCookies bool
+}
+
+func (h *OIDCHandler) BeginOIDCLogin(c *gin.Context) {
+	if h.OIDCService == nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return
+	}
+
+	authorizationURL, err := h.OIDCService.BeginLogin()
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.StatusOKJSONPayloadResponse(c, gin.H{"authorization_url": authorizationURL})
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *OIDCHandler) CompleteOIDCLogin(c *gin.Context) {
+	if h.OIDCService == nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return
+	}
+
+	var input struct {
+		State   string `json:"state"`
+		Code    string `json:"code"`
+		Session bool   `json:"session"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.State != "", "state", "must be provided")
+	v.Check(input.Code != "", "code", "must be provided")
+
+	if !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	user, err := h.OIDCService.CompleteLogin(c, input.State, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			v.AddError("state", "invalid or expired login state")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		case errors.Is(err, oidc.ErrExchangeFailed), errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, oidc.ErrUnknownKey):
+			httphelpers.StatusUnauthorizedJSONPayloadResponse(c, gin.H{"error": "the identity provider login could not be verified"})
+		case errors.Is(err, models.ErrEmailNotVerified):
+			httphelpers.StatusForbiddenJSONPayloadResponse(c, gin.H{"error": "the identity provider has not verified your email address"})
+		case errors.Is(err, models.ErrMFALinkRefused):
+			httphelpers.StatusForbiddenJSONPayloadResponse(c, gin.H{"error": "an account with two-factor authentication can't be linked to an identity provider login"})
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	completeLogin(c, h.TokenRepo, h.TokenService, h.MFAService, user, input.Session, h.SecureCookies)
+}
@@ -1,27 +1,48 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"errors"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"greenlight/internal/repositoryerrors"
 	"greenlight/internal/users/models"
 	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/mailer"
+	"greenlight/pkg/taskutils"
 	"greenlight/pkg/validator"
 
 	"github.com/gin-gonic/gin"
 )
 
 type TokenHandler struct {
-	UserRepo  UserRepo
-	TokenRepo TokenRepo
+	UserRepo           UserRepo
+	TokenRepo          TokenRepo
+	Logger             Logger
+	Mailer             mailer.Mailer
+	UserService        UserService
+	TokenService       TokenService
+	MFAService         MFAService
+	ActivationThrottle Throttle
+	LoginGuard         LoginGuard
+	MagicLinkThrottle  Throttle
+	// MagicLinkURL is where the login links are sent to, with the token appended as the token
+	// query parameter. When empty the email only contains the token.
+	MagicLinkURL string
+	// SecureCookies marks session cookies Secure, it is only turned off to develop over plain HTTP
+	SecureCookies bool
 }
 
 func (h TokenHandler) CreateAuthenticationToken(c *gin.Context) {
 	var input struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Session  bool   `json:"session"`
 	}
 
 	err := httphelpers.JSONDecode(c, &input)
@@ -40,10 +61,32 @@ func (h TokenHandler) CreateAuthenticationToken(c *gin.Context) {
 		return
 	}
 
+	ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	decision, err := h.LoginGuard.Check(input.Email, ip)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	if !decision.Allowed {
+		httphelpers.LoginThrottledResponse(c, decision.RetryAfter, decision.Locked)
+		return
+	}
+
 	user, err := h.UserRepo.GetByEmail(c, input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			// Unknown addresses are counted too, so they get throttled like registered ones.
+			if _, _, err := h.LoginGuard.RecordFailure(input.Email, ip); err != nil {
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+				return
+			}
 			httphelpers.StatusUnauthorizedJSONPayloadResponse(c, "invalid credentials")
 		default:
 			httphelpers.StatusInternalServerErrorResponse(c, err)
@@ -58,19 +101,549 @@ func (h TokenHandler) CreateAuthenticationToken(c *gin.Context) {
 	}
 
 	if !match {
+		attempt, locked, err := h.LoginGuard.RecordFailure(input.Email, ip)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		if locked {
+			go func() {
+				taskutils.BackgroundTask(h.Logger, func() {
+					data := map[string]any{
+						"failures":    attempt.Failures,
+						"lockedUntil": attempt.LockedUntil.UTC().Format(time.RFC1123),
+					}
+					err := h.Mailer.Send(user.Email, "account_locked.tmpl", data)
+					if err != nil {
+						h.Logger.PrintError(err, nil)
+					}
+				})
+			}()
+		}
+
 		httphelpers.StatusUnauthorizedJSONPayloadResponse(c, "invalid credentials")
 		return
 	}
 
-	token, err := h.TokenRepo.New(user.ID, 24*time.Hour, models.ScopeAuthentication)
+	err = h.LoginGuard.RecordSuccess(input.Email)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	// Saving the upgraded hash is best effort, the next login will simply try again.
+	if user.Password.Rehashed() {
+		err = h.UserRepo.Update(c, user)
+		if err != nil && !errors.Is(err, repositoryerrors.ErrEditConflict) {
+			h.Logger.PrintError(err, nil)
+		}
+	}
+
+	h.completeLogin(c, user, input.Session)
+}
+
+func (h TokenHandler) completeLogin(c *gin.Context, user *models.User, session bool) {
+	completeLogin(c, h.TokenRepo, h.TokenService, h.MFAService, user, session, h.SecureCookies)
+}
+
+// completeLogin answers a successful first factor, a password, a magic link or an identity
+// provider login, with either the authentication tokens or, when two-factor authentication is
+// on, an mfa token
+func completeLogin(c *gin.Context, tokenRepo TokenRepo, tokenService TokenService, mfaService MFAService, user *models.User, session, secureCookies bool) {
+	if user.Suspended {
+		httphelpers.AccountSuspendedResponse(c)
+		return
+	}
+
+	mfaEnabled, err := mfaService.Enabled(user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	// With two-factor authentication on, the first factor only buys a short-lived token that has
+	// to be exchanged, together with a code, at POST /v1/tokens/mfa.
+	if mfaEnabled {
+		token, err := tokenRepo.New(user.ID, 5*time.Minute, models.ScopeMFAPending)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusAccepted, gin.H{"mfa_token": token}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	tokens, err := tokenService.IssueAuthenticationTokens(user)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	authenticationTokensResponse(c, tokens, session, secureCookies)
+}
+
+// authenticationTokensResponse sends tokens in the response body, or, for browser sessions, in
+// HttpOnly cookies while the body only carries the CSRF token scripts have to send back.
+func authenticationTokensResponse(c *gin.Context, tokens *models.AuthenticationTokens, session, secureCookies bool) {
+	var payload any = tokens
+
+	if session {
+		httphelpers.SetSessionCookies(c, tokens, secureCookies)
+		payload = gin.H{"csrf_token": httphelpers.CSRFToken(tokens.Access.Plaintext), "expiry": tokens.Access.Expiry}
+	}
+
+	err := httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, payload, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h TokenHandler) CreateAuthenticationTokenFromMFA(c *gin.Context) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+		Code           string `json:"code"`
+		Session        bool   `json:"session"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	models.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	v.Check(input.Code != "", "code", "must be provided")
+
+	if !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	user, err := h.UserRepo.GetForToken(models.ScopeMFAPending, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusUnauthorizedJSONPayloadResponse(c, gin.H{"error": "invalid or expired mfa token"})
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	// Once the codes of a user are locked, their pending mfa tokens are spent too, trying again
+	// takes the first factor again.
+	decision, err := h.LoginGuard.CheckMFA(user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	if !decision.Allowed {
+		err = h.TokenRepo.DeleteAllForUser(models.ScopeMFAPending, user.ID)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		httphelpers.LoginThrottledResponse(c, decision.RetryAfter, decision.Locked)
+		return
+	}
+
+	ok, err := h.MFAService.Verify(user.ID, input.Code)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	if !ok {
+		attempt, locked, err := h.LoginGuard.RecordMFAFailure(user.ID)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		if locked {
+			err = h.TokenRepo.DeleteAllForUser(models.ScopeMFAPending, user.ID)
+			if err != nil {
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+				return
+			}
+
+			httphelpers.LoginThrottledResponse(c, time.Until(*attempt.LockedUntil), true)
+			return
+		}
+
+		httphelpers.StatusUnauthorizedJSONPayloadResponse(c, gin.H{"error": "invalid code"})
+		return
+	}
+
+	err = h.LoginGuard.RecordMFASuccess(user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = h.TokenRepo.DeleteAllForUser(models.ScopeMFAPending, user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	tokens, err := h.TokenService.IssueAuthenticationTokens(user)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	authenticationTokensResponse(c, tokens, input.Session, h.SecureCookies)
+}
+
+func (h TokenHandler) RefreshAuthenticationToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	// Browser sessions keep their refresh token in a cookie, and get the new ones back the same
+	// way. Browsers send the cookie along whichever site the request comes from, so the request
+	// also has to carry the CSRF token of the session, which only its pages were handed.
+	var session bool
+	if input.RefreshToken == "" {
+		if cookie, err := c.Cookie(httphelpers.RefreshCookie); err == nil && cookie != "" {
+			sessionToken, _ := c.Cookie(httphelpers.SessionCookie)
+			if sessionToken == "" || !httphelpers.ValidCSRFToken(sessionToken, c.GetHeader(httphelpers.CSRFHeader)) {
+				httphelpers.StatusForbiddenJSONPayloadResponse(c, gin.H{"error": "invalid or missing CSRF token"})
+				return
+			}
+
+			input.RefreshToken = cookie
+			session = true
+		}
+	}
+
+	v := validator.New()
+
+	v.Check(input.RefreshToken != "", "refresh_token", "must be provided")
+	v.Check(len(input.RefreshToken) == 26, "refresh_token", "must be 26 bytes in length")
+
+	if !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	tokens, err := h.TokenService.RefreshAuthenticationTokens(input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusUnauthorizedJSONPayloadResponse(c, gin.H{"error": "invalid or expired refresh token"})
+		case errors.Is(err, models.ErrAccountSuspended):
+			httphelpers.AccountSuspendedResponse(c)
+		case errors.Is(err, models.ErrRefreshTokenReused):
+			httphelpers.StatusUnauthorizedJSONPayloadResponse(c, gin.H{"error": "refresh token has already been used, every token issued with it has been revoked"})
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	authenticationTokensResponse(c, tokens, session, h.SecureCookies)
+}
+
+func (h TokenHandler) CreatePasswordResetToken(c *gin.Context) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	if models.ValidateEmail(v, input.Email); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	// The same response is sent whether or not the email belongs to an activated account,
+	// so this endpoint can't be used to find out which addresses are registered.
+	message := gin.H{"message": "if an activated account exists for that email address, you will receive password reset instructions"}
+
+	user, err := h.UserRepo.GetByEmail(c, input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusAccepted, message, nil)
+			if err != nil {
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	if user.Activated {
+		err = h.UserService.RequestPasswordReset(user)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusAccepted, message, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h TokenHandler) CreateActivationToken(c *gin.Context) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	if models.ValidateEmail(v, input.Email); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	// Resends are counted per address whether or not it belongs to an account, so being
+	// throttled doesn't reveal anything either.
+	if !h.ActivationThrottle.Allow(strings.ToLower(input.Email)) {
+		httphelpers.RateLimitExceededResponse(c)
+		return
+	}
+
+	err = h.UserService.ResendActivation(c, input.Email)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	message := gin.H{"message": "if an account with that email address is awaiting activation, you will receive activation instructions"}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusAccepted, message, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h TokenHandler) CreateMagicLinkToken(c *gin.Context) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	if models.ValidateEmail(v, input.Email); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	if !h.MagicLinkThrottle.Allow(strings.ToLower(input.Email)) {
+		httphelpers.RateLimitExceededResponse(c)
+		return
+	}
+
+	// As with password resets, the response doesn't tell whether the address is registered.
+	message := gin.H{"message": "if an activated account exists for that email address, you will receive a login link"}
+
+	user, err := h.UserRepo.GetByEmail(c, input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusAccepted, message, nil)
+			if err != nil {
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	if user.Activated {
+		token, err := h.TokenRepo.New(user.ID, 15*time.Minute, models.ScopeMagicLink)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		var link string
+		if h.MagicLinkURL != "" {
+			link = h.MagicLinkURL + "?" + url.Values{"token": {token.Plaintext}}.Encode()
+		}
+
+		go func() {
+			taskutils.BackgroundTask(h.Logger, func() {
+				data := map[string]any{
+					"magicLinkToken": token.Plaintext,
+					"magicLink":      link,
+				}
+				err := h.Mailer.Send(user.Email, "token_magic_link.tmpl", data)
+				if err != nil {
+					h.Logger.PrintError(err, nil)
+				}
+			})
+		}()
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusAccepted, message, nil)
 	if err != nil {
 		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h TokenHandler) ExchangeMagicLinkToken(c *gin.Context) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+		Session        bool   `json:"session"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
 		return
 	}
 
-	httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"token": token}, nil)
+	v := validator.New()
+
+	if models.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	userID, err := h.TokenRepo.Redeem(models.ScopeMagicLink, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusUnauthorizedJSONPayloadResponse(c, gin.H{"error": "invalid or expired magic link token"})
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	user, err := h.UserRepo.GetByID(c, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusUnauthorizedJSONPayloadResponse(c, gin.H{"error": "invalid or expired magic link token"})
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	h.completeLogin(c, user, input.Session)
+}
+
+func (h TokenHandler) ListTokens(c *gin.Context) {
+	user := httphelpers.ContextGetUser(c)
+
+	tokens, err := h.TokenRepo.GetAllForUser(user.ID, models.ScopeAuthentication, models.ScopeRefresh)
 	if err != nil {
 		httphelpers.StatusInternalServerErrorResponse(c, err)
 		return
 	}
+
+	currentHash := sha256.Sum256([]byte(httphelpers.ContextGetToken(c)))
+
+	// Signed tokens aren't stored, their session shows up as the refresh token of their family.
+	currentFamily := h.TokenService.Family(httphelpers.ContextGetToken(c))
+
+	sessions := make([]models.Session, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, models.Session{
+			Scope:     token.Scope,
+			CreatedAt: token.CreatedAt,
+			Expiry:    token.Expiry,
+			Current:   bytes.Equal(token.Hash, currentHash[:]) || (currentFamily != nil && bytes.Equal(token.Family, currentFamily)),
+		})
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"tokens": sessions}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h TokenHandler) DeleteAuthenticationToken(c *gin.Context) {
+	err := h.TokenService.RevokeAuthenticationToken(httphelpers.ContextGetToken(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusUnauthorizedResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "token successfully revoked"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h TokenHandler) DeleteAllAuthenticationTokens(c *gin.Context) {
+	user := httphelpers.ContextGetUser(c)
+
+	err := h.TokenService.RevokeAllAuthenticationTokens(user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "all tokens successfully revoked"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// DeleteSession logs a browser session out. The cookies are cleared even when the session has
+// already expired.
+func (h TokenHandler) DeleteSession(c *gin.Context) {
+	if token := httphelpers.ContextGetToken(c); token != "" {
+		err := h.TokenService.RevokeAuthenticationToken(token)
+		if err != nil && !errors.Is(err, repositoryerrors.ErrRecordNotFound) {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+	}
+
+	httphelpers.ClearSessionCookies(c, h.SecureCookies)
+
+	err := httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "you have been logged out"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
 }
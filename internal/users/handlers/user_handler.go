@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"greenlight/internal/repositoryerrors"
@@ -24,14 +25,22 @@ type Logger interface {
 type UserRepo interface {
 	Insert(context.Context, *models.User) error
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetByID(ctx context.Context, id int64) (*models.User, error)
 	Update(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, id int64) error
 	GetForToken(tokenScope, tokenPlaintext string) (*models.User, error)
+	GetAll(ctx context.Context, search string, activated, suspended *bool, filters httphelpers.Filters) ([]*models.User, httphelpers.Metadata, error)
 }
 
 type TokenRepo interface {
 	New(userID int64, ttl time.Duration, scope string) (*models.Token, error)
 	Insert(token *models.Token) error
+	GetForPlaintext(scope, tokenPlaintext string) (*models.Token, error)
+	GetAllForUser(userID int64, scopes ...string) ([]*models.Token, error)
+	Delete(scope, tokenPlaintext string) error
+	Redeem(scope, tokenPlaintext string) (int64, error)
 	DeleteAllForUser(scope string, userID int64) error
+	DeleteAllForUserExcept(scope string, userID int64, tokenPlaintext string) error
 }
 
 type PermissionsRepo interface {
@@ -41,6 +50,38 @@ type PermissionsRepo interface {
 type UserService interface {
 	RegisterUser(context context.Context, user models.User) (*models.User, error)
 	ActivateUser(context context.Context, tokenPlaintext string) (*models.User, error)
+	ResetPassword(context context.Context, tokenPlaintext, password string) (*models.User, error)
+	ResendActivation(context context.Context, email string) error
+	UpdateUser(context context.Context, user *models.User, currentToken string) error
+	DeleteUser(context context.Context, user *models.User) error
+	CheckEmailAvailable(context context.Context, email string) error
+	RequestEmailChange(context context.Context, user *models.User, newEmail string) error
+	ConfirmEmailChange(context context.Context, tokenPlaintext string) (*models.User, error)
+	RequestPasswordReset(user *models.User) error
+	ForcePasswordReset(context context.Context, user *models.User) error
+}
+
+type TokenService interface {
+	IssueAuthenticationTokens(user *models.User) (*models.AuthenticationTokens, error)
+	RefreshAuthenticationTokens(refreshTokenPlaintext string) (*models.AuthenticationTokens, error)
+	RevokeAuthenticationToken(tokenPlaintext string) error
+	Family(tokenPlaintext string) []byte
+	RevokeAllAuthenticationTokens(userID int64) error
+	RevokeAccessTokens(userID int64) error
+}
+
+type Throttle interface {
+	Allow(key string) bool
+}
+
+type LoginGuard interface {
+	Check(email, ip string) (models.LoginDecision, error)
+	RecordFailure(email, ip string) (*models.LoginAttempt, bool, error)
+	RecordSuccess(email string) error
+	Clear(user *models.User) error
+	CheckMFA(userID int64) (models.LoginDecision, error)
+	RecordMFAFailure(userID int64) (*models.LoginAttempt, bool, error)
+	RecordMFASuccess(userID int64) error
 }
 
 type UserHandler struct {
@@ -141,3 +182,304 @@ func (h *UserHandler) ActivateUser(c *gin.Context) {
 		httphelpers.StatusInternalServerErrorResponse(c, err)
 	}
 }
+
+type UpdateUserPasswordInput struct {
+	Password       string `json:"password"`
+	TokenPlaintext string `json:"token"`
+}
+
+func (h *UserHandler) UpdateUserPassword(c *gin.Context) {
+	var input UpdateUserPasswordInput
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	models.ValidatePasswordPlaintext(v, input.Password)
+	models.ValidateTokenPlaintext(v, input.TokenPlaintext)
+
+	if !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	// The owner of the token is needed to check the new password doesn't contain their name
+	// or email address.
+	user, err := h.UserRepo.GetForToken(models.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	if models.ValidatePasswordPolicy(v, input.Password, user.Name, user.Email); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	_, err = h.UserService.ResetPassword(c, input.TokenPlaintext, input.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		case errors.Is(err, repositoryerrors.ErrEditConflict):
+			httphelpers.StatusConflictResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// currentUser reloads the authenticated user, as users authenticated with a signed token only
+// carry their ID and activation state in the request context
+func (h *UserHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	user, err := h.UserRepo.GetByID(c, httphelpers.ContextGetUser(c).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusUnauthorizedResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (h *UserHandler) ShowCurrentUser(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	err := httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"user": user}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+type UpdateCurrentUserInput struct {
+	Name            *string `json:"name"`
+	Email           *string `json:"email"`
+	Password        *string `json:"password"`
+	CurrentPassword *string `json:"current_password"`
+}
+
+func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
+	var input UpdateCurrentUserInput
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	// A new email address only replaces the current one once it is confirmed, see ConfirmEmailChange
+	var newEmail string
+	if input.Email != nil && !strings.EqualFold(*input.Email, user.Email) {
+		newEmail = *input.Email
+		models.ValidateEmail(v, newEmail)
+	}
+
+	if input.Password != nil {
+		if input.CurrentPassword == nil {
+			v.AddError("current_password", "must be provided to change the password")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		match, err := user.Password.Matches(*input.CurrentPassword)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		if !match {
+			v.AddError("current_password", "is incorrect")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		err = user.Password.Set(*input.Password)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+	}
+
+	if models.ValidateUser(v, user); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	// The new email address is checked before anything is saved, so a taken address doesn't leave
+	// the other changes half applied.
+	if newEmail != "" {
+		err = h.UserService.CheckEmailAvailable(c, newEmail)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositoryerrors.ErrDuplicateEmail):
+				v.AddError("email", "a user with that email address already exists")
+				httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+	}
+
+	err = h.UserService.UpdateUser(c, user, httphelpers.ContextGetToken(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrEditConflict):
+			httphelpers.StatusConflictResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	payload := gin.H{"user": user}
+
+	if newEmail != "" {
+		err = h.UserService.RequestEmailChange(c, user, newEmail)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositoryerrors.ErrDuplicateEmail):
+				v.AddError("email", "a user with that email address already exists")
+				httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		payload["message"] = "a confirmation email has been sent to the new email address"
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, payload, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+type DeleteCurrentUserInput struct {
+	Password string `json:"password"`
+}
+
+func (h *UserHandler) DeleteCurrentUser(c *gin.Context) {
+	var input DeleteCurrentUserInput
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.Password != "", "password", "must be provided"); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	if !match {
+		v.AddError("password", "is incorrect")
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	err = h.UserService.DeleteUser(c, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "account successfully deleted"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+type ConfirmEmailChangeInput struct {
+	TokenPlaintext string `json:"token"`
+}
+
+func (h *UserHandler) ConfirmEmailChange(c *gin.Context) {
+	var input ConfirmEmailChangeInput
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	if models.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	user, err := h.UserService.ConfirmEmailChange(c, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		case errors.Is(err, repositoryerrors.ErrDuplicateEmail):
+			v.AddError("email", "a user with that email address already exists")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		case errors.Is(err, repositoryerrors.ErrEditConflict):
+			httphelpers.StatusConflictResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"user": user}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrEmailNotVerified = errors.New("identity provider did not verify the email address")
+	ErrMFALinkRefused   = errors.New("accounts with two-factor authentication are not linked by email")
+)
+
+// Identity links a user to their account at an external identity provider
+type Identity struct {
+	Provider  string
+	Subject   string
+	UserID    int64
+	CreatedAt time.Time
+}
+
+// OIDCState is what has to be remembered between sending a user to the identity provider and
+// them coming back with an authorization code
+type OIDCState struct {
+	Nonce        string
+	CodeVerifier string
+	Expiry       time.Time
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// LoginAttempt counts the recent failed logins of a key, an email address, an IP, or the user
+// a second factor code was tried for
+type LoginAttempt struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// LoginDecision tells whether a login may be attempted right now. When it may not, RetryAfter
+// says how long to wait, and Locked whether the account itself is locked rather than the
+// attempt merely delayed.
+type LoginDecision struct {
+	Allowed    bool
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func EmailLoginKey(email string) string {
+	return "email:" + email
+}
+
+func IPLoginKey(ip string) string {
+	return "ip:" + ip
+}
+
+func MFALoginKey(userID int64) string {
+	return "mfa:" + strconv.FormatInt(userID, 10)
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
+	"errors"
 	"time"
 
 	"greenlight/pkg/validator"
@@ -12,14 +13,40 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeEmailChange    = "email-change"
+	ScopeRefresh        = "refresh"
+	ScopeMFAPending     = "mfa-pending"
+	ScopeMagicLink      = "magic-link"
 )
 
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
 type Token struct {
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	CreatedAt time.Time `json:"-"`
+	// Email holds the requested address for ScopeEmailChange tokens
+	Email *string `json:"-"`
+	// Family groups an authentication token with the refresh tokens it was issued or rotated with
+	Family []byte     `json:"-"`
+	UsedAt *time.Time `json:"-"`
+}
+
+type AuthenticationTokens struct {
+	Access  *Token `json:"token"`
+	Refresh *Token `json:"refresh_token"`
+}
+
+// Session describes an active token without exposing its plaintext or hash
+type Session struct {
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"created_at"`
+	Expiry    time.Time `json:"expiry"`
+	Current   bool      `json:"current"`
 }
 
 func GenerateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
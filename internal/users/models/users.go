@@ -1,16 +1,31 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"time"
 
+	"greenlight/pkg/passwordhash"
+	"greenlight/pkg/passwordpolicy"
 	"greenlight/pkg/validator"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 var AnonymousUser = &User{}
 
+var ErrAccountSuspended = errors.New("account suspended")
+
+// PasswordHasher hashes new passwords with argon2id, and still verifies the bcrypt hashes
+// stored before it, so they can be upgraded as their owners log in.
+var PasswordHasher = passwordhash.New(
+	passwordhash.NewArgon2id(passwordhash.DefaultArgon2idParams),
+	passwordhash.NewBcrypt(12),
+)
+
+// PasswordPolicy is applied to every new password, not when logging in, so users with a password
+// predating it are not locked out.
+var PasswordPolicy = passwordpolicy.New(40, nil)
+
 type User struct {
 	ID        int64     `json:"id" db:"id"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
@@ -18,16 +33,18 @@ type User struct {
 	Email     string    `json:"email" db:"email"`
 	Password  Password  `json:"-" db:"password_hash"`
 	Activated bool      `json:"activated" db:"activated"`
+	Suspended bool      `json:"suspended" db:"suspended"`
 	Version   int       `json:"-" db:"version"`
 }
 
 type Password struct {
 	Plaintext *string
 	Hash      []byte
+	rehashed  bool
 }
 
 func (p *Password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := PasswordHasher.Hash(plaintextPassword)
 	if err != nil {
 		return err
 	}
@@ -38,19 +55,44 @@ func (p *Password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// Matches checks plaintextPassword against the hash. When it matches an outdated hash, the hash
+// is replaced by an up to date one, and Rehashed reports it so the user can be saved.
 func (p *Password) Matches(plaintextPassword string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(p.Hash, []byte(plaintextPassword))
-	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
+	match, err := PasswordHasher.Verify(p.Hash, plaintextPassword)
+	if err != nil || !match {
+		return false, err
+	}
+
+	if PasswordHasher.NeedsRehash(p.Hash) {
+		hash, err := PasswordHasher.Hash(plaintextPassword)
+		if err != nil {
 			return false, err
 		}
+
+		p.Hash = hash
+		p.rehashed = true
 	}
+
 	return true, nil
 }
 
+func (p *Password) Rehashed() bool {
+	return p.rehashed
+}
+
+// GenerateRandomPassword returns a password nobody knows, for accounts whose password has to be
+// chosen again through a password reset
+func GenerateRandomPassword() (string, error) {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
@@ -63,7 +105,15 @@ func ValidateEmail(v *validator.Validator, email string) {
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(password != "", "password", "must be provided")
 	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	v.Check(len(password) <= 1000, "password", "must not be more than 1000 bytes long")
+}
+
+// ValidatePasswordPolicy checks a new password against PasswordPolicy, name and email being those
+// of its owner.
+func ValidatePasswordPolicy(v *validator.Validator, password, name, email string) {
+	if message := PasswordPolicy.Check(password, name, email); message != "" {
+		v.AddError("password", message)
+	}
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
@@ -73,6 +123,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 	if user.Password.Plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.Plaintext)
+		ValidatePasswordPolicy(v, *user.Password.Plaintext, user.Name, user.Email)
 	}
 
 	if user.Password.Hash == nil {
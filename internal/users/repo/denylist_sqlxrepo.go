@@ -0,0 +1,141 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"greenlight/pkg/signedtoken"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type DenylistRepo struct {
+	DB *sqlx.DB
+}
+
+func NewDenylistSqlxRepo(db *sqlx.DB) *DenylistRepo {
+	return &DenylistRepo{
+		DB: db,
+	}
+}
+
+func (r *DenylistRepo) Insert(tokenID string, expiry time.Time) error {
+	query := `
+	INSERT INTO token_denylist (token_id, expiry)
+	VALUES ($1, $2)
+	ON CONFLICT (token_id) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, tokenID, expiry)
+	return err
+}
+
+func (r *DenylistRepo) GetAllActive() (map[string]time.Time, error) {
+	query := `
+	SELECT token_id, expiry
+	FROM token_denylist
+	WHERE expiry > $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make(map[string]time.Time)
+
+	for rows.Next() {
+		var (
+			tokenID string
+			expiry  time.Time
+		)
+
+		if err := rows.Scan(&tokenID, &expiry); err != nil {
+			return nil, err
+		}
+		entries[tokenID] = expiry
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// InsertCutoff stores the cutoff of a user, keeping the later one when the user already has one.
+// user_id has no foreign key, the cutoff of a deleted user has to outlive them.
+func (r *DenylistRepo) InsertCutoff(userID int64, cutoff signedtoken.Cutoff) error {
+	query := `
+	INSERT INTO token_denylist_cutoffs (user_id, not_before, expiry)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id) DO UPDATE
+	SET not_before = GREATEST(token_denylist_cutoffs.not_before, EXCLUDED.not_before),
+		expiry = GREATEST(token_denylist_cutoffs.expiry, EXCLUDED.expiry)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, userID, cutoff.NotBefore, cutoff.Expiry)
+	return err
+}
+
+func (r *DenylistRepo) GetAllActiveCutoffs() (map[int64]signedtoken.Cutoff, error) {
+	query := `
+	SELECT user_id, not_before, expiry
+	FROM token_denylist_cutoffs
+	WHERE expiry > $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cutoffs := make(map[int64]signedtoken.Cutoff)
+
+	for rows.Next() {
+		var (
+			userID int64
+			cutoff signedtoken.Cutoff
+		)
+
+		if err := rows.Scan(&userID, &cutoff.NotBefore, &cutoff.Expiry); err != nil {
+			return nil, err
+		}
+		cutoffs[userID] = cutoff
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cutoffs, nil
+}
+
+func (r *DenylistRepo) DeleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	for _, query := range []string{
+		`DELETE FROM token_denylist WHERE expiry <= $1`,
+		`DELETE FROM token_denylist_cutoffs WHERE expiry <= $1`,
+	} {
+		_, err := r.DB.ExecContext(ctx, query, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IdentityRepo struct {
+	DB *sqlx.DB
+}
+
+func NewIdentitySqlxRepo(db *sqlx.DB) *IdentityRepo {
+	return &IdentityRepo{
+		DB: db,
+	}
+}
+
+// Insert links an identity to its user. Linking an identity twice is a no-op.
+func (r *IdentityRepo) Insert(identity *models.Identity) error {
+	query := `
+	INSERT INTO user_identities (provider, subject, user_id)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (provider, subject) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, identity.Provider, identity.Subject, identity.UserID)
+	return err
+}
+
+func (r *IdentityRepo) GetUser(ctx context.Context, provider, subject string) (*models.User, error) {
+	query := `
+	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.suspended, users.version
+	FROM users
+	INNER JOIN user_identities ON user_identities.user_id = users.id
+	WHERE user_identities.provider = $1 AND user_identities.subject = $2`
+
+	var user models.User
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.Hash,
+		&user.Activated,
+		&user.Suspended,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, repositoryerrors.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// InsertState remembers a login in progress. Like tokens, only the hash of the state is stored.
+func (r *IdentityRepo) InsertState(state string, oidcState *models.OIDCState) error {
+	stateHash := sha256.Sum256([]byte(state))
+
+	query := `
+	INSERT INTO oidc_states (hash, nonce, code_verifier, expiry)
+	VALUES ($1, $2, $3, $4)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, stateHash[:], oidcState.Nonce, oidcState.CodeVerifier, oidcState.Expiry)
+	return err
+}
+
+// RedeemState deletes an unexpired state and returns it, so every state can only be used once.
+// Expired states are cleaned up along the way.
+func (r *IdentityRepo) RedeemState(state string) (*models.OIDCState, error) {
+	stateHash := sha256.Sum256([]byte(state))
+
+	query := `
+	DELETE FROM oidc_states
+	WHERE hash = $1 OR expiry <= $2
+	RETURNING hash = $1 AND expiry > $2, nonce, code_verifier, expiry`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, stateHash[:], time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var found *models.OIDCState
+
+	for rows.Next() {
+		var (
+			matches   bool
+			oidcState models.OIDCState
+		)
+
+		err = rows.Scan(&matches, &oidcState.Nonce, &oidcState.CodeVerifier, &oidcState.Expiry)
+		if err != nil {
+			return nil, err
+		}
+
+		if matches {
+			found = &oidcState
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if found == nil {
+		return nil, repositoryerrors.ErrRecordNotFound
+	}
+
+	return found, nil
+}
@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type LoginAttemptRepo struct {
+	DB *sqlx.DB
+}
+
+func NewLoginAttemptSqlxRepo(db *sqlx.DB) *LoginAttemptRepo {
+	return &LoginAttemptRepo{
+		DB: db,
+	}
+}
+
+func (r *LoginAttemptRepo) Get(key string) (*models.LoginAttempt, error) {
+	query := `
+	SELECT key, failures, last_failure_at, locked_until
+	FROM login_attempts
+	WHERE key = $1`
+
+	var attempt models.LoginAttempt
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, key).Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &attempt.LockedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, repositoryerrors.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &attempt, nil
+}
+
+// RecordFailure counts a failed login for key. Failures older than windowStart are forgotten
+// and the count starts over.
+func (r *LoginAttemptRepo) RecordFailure(key string, windowStart time.Time) (*models.LoginAttempt, error) {
+	query := `
+	INSERT INTO login_attempts (key, failures, last_failure_at)
+	VALUES ($1, 1, NOW())
+	ON CONFLICT (key) DO UPDATE
+	SET failures = CASE WHEN login_attempts.last_failure_at < $2 THEN 1 ELSE login_attempts.failures + 1 END,
+		last_failure_at = NOW()
+	RETURNING key, failures, last_failure_at, locked_until`
+
+	var attempt models.LoginAttempt
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, key, windowStart).Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &attempt.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+func (r *LoginAttemptRepo) Lock(key string, until time.Time) error {
+	query := `
+	UPDATE login_attempts
+	SET locked_until = $2
+	WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, key, until)
+	return err
+}
+
+func (r *LoginAttemptRepo) Delete(key string) error {
+	query := `DELETE FROM login_attempts WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, key)
+	return err
+}
@@ -2,11 +2,16 @@ package repo
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
 	"time"
 
+	"greenlight/internal/repositoryerrors"
 	"greenlight/internal/users/models"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type TokenRepo struct {
@@ -32,11 +37,11 @@ func (r TokenRepo) New(userID int64, ttl time.Duration, scope string) (*models.T
 
 func (r *TokenRepo) Insert(token *models.Token) error {
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO tokens (hash, user_id, expiry, scope, email, family)
+	VALUES ($1, $2, $3, $4, $5, $6)
 	`
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.Email, token.Family}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -45,6 +50,121 @@ func (r *TokenRepo) Insert(token *models.Token) error {
 	return err
 }
 
+func (r *TokenRepo) GetForPlaintext(scope, tokenPlaintext string) (*models.Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	SELECT hash, user_id, expiry, scope, email, family, used_at
+	FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry > $3
+	`
+
+	token := models.Token{Plaintext: tokenPlaintext}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, tokenHash[:], scope, time.Now()).Scan(
+		&token.Hash,
+		&token.UserID,
+		&token.Expiry,
+		&token.Scope,
+		&token.Email,
+		&token.Family,
+		&token.UsedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, repositoryerrors.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &token, nil
+}
+
+func (r *TokenRepo) GetAllForUser(userID int64, scopes ...string) ([]*models.Token, error) {
+	query := `
+	SELECT hash, user_id, expiry, scope, created_at, family
+	FROM tokens
+	WHERE user_id = $1 AND scope = ANY($2) AND expiry > $3 AND used_at IS NULL
+	ORDER BY created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, userID, pq.Array(scopes), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*models.Token{}
+
+	for rows.Next() {
+		var token models.Token
+
+		err := rows.Scan(&token.Hash, &token.UserID, &token.Expiry, &token.Scope, &token.CreatedAt, &token.Family)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, &token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (r *TokenRepo) Delete(scope, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	DELETE FROM tokens
+	WHERE scope = $1 AND hash = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, scope, tokenHash[:])
+	return err
+}
+
+// Redeem deletes an unexpired token and returns the ID of its user. A token can only be redeemed
+// once, even by concurrent requests.
+func (r *TokenRepo) Redeem(scope, tokenPlaintext string) (int64, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	DELETE FROM tokens
+	WHERE scope = $1 AND hash = $2 AND expiry > $3
+	RETURNING user_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID int64
+
+	err := r.DB.QueryRowContext(ctx, query, scope, tokenHash[:], time.Now()).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, repositoryerrors.ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
 func (r *TokenRepo) DeleteAllForUser(scope string, userID int64) error {
 	query := `
 	DELETE FROM tokens
@@ -57,3 +177,77 @@ func (r *TokenRepo) DeleteAllForUser(scope string, userID int64) error {
 	_, err := r.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteAllForUserExcept deletes every token of the user in scope, except the one matching
+// tokenPlaintext and the tokens of its family. Tokens issued before families existed have none,
+// when the current token has no family, or isn't stored at all, only the token itself is kept.
+func (r *TokenRepo) DeleteAllForUserExcept(scope string, userID int64, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	WITH current_token AS (SELECT family FROM tokens WHERE hash = $3)
+	DELETE FROM tokens
+	WHERE scope = $1 AND user_id = $2 AND hash <> $3
+	AND (
+		(SELECT family FROM current_token) IS NULL
+		OR family IS DISTINCT FROM (SELECT family FROM current_token)
+	)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, scope, userID, tokenHash[:])
+	return err
+}
+
+// DeleteAllForUserExceptFamily deletes every token of the user in scope outside of family
+func (r *TokenRepo) DeleteAllForUserExceptFamily(scope string, userID int64, family []byte) error {
+	query := `
+	DELETE FROM tokens
+	WHERE scope = $1 AND user_id = $2 AND family IS DISTINCT FROM $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, scope, userID, family)
+	return err
+}
+
+// Consume marks a token as used, and reports false if it had already been used
+func (r *TokenRepo) Consume(hash []byte) (bool, error) {
+	query := `
+	UPDATE tokens
+	SET used_at = NOW()
+	WHERE hash = $1 AND used_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, hash)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (r *TokenRepo) DeleteFamily(family []byte) error {
+	query := `
+	DELETE FROM tokens
+	WHERE family = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, family)
+	return err
+}
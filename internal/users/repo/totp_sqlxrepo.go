@@ -0,0 +1,179 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type TOTPRepo struct {
+	DB *sqlx.DB
+}
+
+func NewTOTPSqlxRepo(db *sqlx.DB) *TOTPRepo {
+	return &TOTPRepo{
+		DB: db,
+	}
+}
+
+// Upsert stores a new, not yet enabled secret for the user. It returns
+// models.ErrTOTPAlreadyEnabled instead of replacing the secret of an enabled enrollment.
+func (r *TOTPRepo) Upsert(userID int64, secret []byte) error {
+	query := `
+	INSERT INTO users_totp (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+	WHERE users_totp.enabled = false`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return models.ErrTOTPAlreadyEnabled
+	}
+
+	return nil
+}
+
+func (r *TOTPRepo) Get(userID int64) (*models.TOTP, error) {
+	query := `
+	SELECT user_id, secret, enabled, last_used_step
+	FROM users_totp
+	WHERE user_id = $1`
+
+	var totp models.TOTP
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, userID).Scan(&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastUsedStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, repositoryerrors.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &totp, nil
+}
+
+// Enable turns on two-factor authentication and replaces the user's recovery codes
+func (r *TOTPRepo) Enable(userID int64, step int64, recoveryCodeHashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE users_totp SET enabled = true, last_used_step = $2 WHERE user_id = $1`, userID, step)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM users_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO users_recovery_codes (hash, user_id) VALUES ($1, $2)`, hash, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records step as the last one a code was accepted for, and reports false if that step,
+// or a later one, was already used. This stops a code from being replayed.
+func (r *TOTPRepo) UseStep(userID int64, step int64) (bool, error) {
+	query := `
+	UPDATE users_totp
+	SET last_used_step = $2
+	WHERE user_id = $1 AND last_used_step < $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks a recovery code as used, and reports false if it doesn't exist or was
+// already used
+func (r *TOTPRepo) UseRecoveryCode(userID int64, hash []byte) (bool, error) {
+	query := `
+	UPDATE users_recovery_codes
+	SET used_at = NOW()
+	WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (r *TOTPRepo) Delete(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM users_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM users_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
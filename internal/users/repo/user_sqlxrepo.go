@@ -5,10 +5,12 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"greenlight/internal/repositoryerrors"
 	"greenlight/internal/users/models"
+	"greenlight/pkg/httphelpers"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -49,7 +51,7 @@ func (r *UserRepo) Insert(ctx context.Context, user *models.User) error {
 
 func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, suspended, version
 		FROM users
 		WHERE email = $1`
 
@@ -65,6 +67,7 @@ func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*models.User,
 		&user.Email,
 		&user.Password.Hash,
 		&user.Activated,
+		&user.Suspended,
 		&user.Version,
 	)
 	if err != nil {
@@ -79,11 +82,100 @@ func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*models.User,
 	return &user, nil
 }
 
+func (r *UserRepo) GetByID(ctx context.Context, id int64) (*models.User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, suspended, version
+		FROM users
+		WHERE id = $1`
+
+	var user models.User
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRowxContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.Hash,
+		&user.Activated,
+		&user.Suspended,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, repositoryerrors.ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// GetAll lists users whose name or email contains search, when it isn't empty. A nil activated
+// or suspended matches users in either state.
+func (r *UserRepo) GetAll(ctx context.Context, search string, activated, suspended *bool, filters httphelpers.Filters) ([]*models.User, httphelpers.Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, email, password_hash, activated, suspended, version
+		FROM users
+		WHERE (strpos(lower(name), lower($1)) > 0 OR strpos(lower(email), lower($1)) > 0 OR $1 = '')
+		AND ($2::boolean IS NULL OR activated = $2)
+		AND ($3::boolean IS NULL OR suspended = $3)
+		ORDER BY %s %s, id ASC
+		LIMIT $4 OFFSET $5`, filters.SortColumn(), filters.SortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	args := []any{search, activated, suspended, filters.Limit(), filters.Offset()}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*models.User{}
+
+	for rows.Next() {
+		var user models.User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.Hash,
+			&user.Activated,
+			&user.Suspended,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, httphelpers.Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+
+	metadata := httphelpers.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
 func (r *UserRepo) Update(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET name = $1, email = $2, password_hash = $3, activated = $4, suspended = $5, version = version + 1
+		WHERE id = $6 AND version = $7
 		RETURNING version`
 
 	args := []any{
@@ -91,6 +183,7 @@ func (r *UserRepo) Update(ctx context.Context, user *models.User) error {
 		user.Email,
 		user.Password.Hash,
 		user.Activated,
+		user.Suspended,
 		user.ID,
 		user.Version,
 	}
@@ -113,17 +206,41 @@ func (r *UserRepo) Update(ctx context.Context, user *models.User) error {
 	return nil
 }
 
+func (r *UserRepo) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM users WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return repositoryerrors.ErrRecordNotFound
+	}
+
+	return nil
+}
+
 func (r *UserRepo) GetForToken(tokenScope, tokenPlaintext string) (*models.User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.suspended, users.version
 		FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
 		WHERE tokens.hash = $1
 		AND tokens.scope = $2 
-		AND tokens.expiry > $3`
+		AND tokens.expiry > $3
+		AND NOT users.suspended`
 
 	args := []any{tokenHash[:], tokenScope, time.Now()}
 
@@ -140,6 +257,7 @@ func (r *UserRepo) GetForToken(tokenScope, tokenPlaintext string) (*models.User,
 		&user.Email,
 		&user.Password.Hash,
 		&user.Activated,
+		&user.Suspended,
 		&user.Version,
 	)
 	if err != nil {
@@ -1,27 +1,99 @@
 package router
 
 import (
+	permissionsModels "greenlight/internal/permissions/models"
+	"greenlight/pkg/middlewares"
+
 	"github.com/gin-gonic/gin"
 )
 
 type UserHandler interface {
 	Register(c *gin.Context)
 	ActivateUser(c *gin.Context)
+	UpdateUserPassword(c *gin.Context)
+	ShowCurrentUser(c *gin.Context)
+	UpdateCurrentUser(c *gin.Context)
+	DeleteCurrentUser(c *gin.Context)
+	ConfirmEmailChange(c *gin.Context)
 }
 
 type TokenHandler interface {
 	CreateAuthenticationToken(c *gin.Context)
+	RefreshAuthenticationToken(c *gin.Context)
+	CreateAuthenticationTokenFromMFA(c *gin.Context)
+	CreatePasswordResetToken(c *gin.Context)
+	CreateActivationToken(c *gin.Context)
+	CreateMagicLinkToken(c *gin.Context)
+	ExchangeMagicLinkToken(c *gin.Context)
+	ListTokens(c *gin.Context)
+	DeleteAuthenticationToken(c *gin.Context)
+	DeleteAllAuthenticationTokens(c *gin.Context)
+	DeleteSession(c *gin.Context)
+}
+
+type MFAHandler interface {
+	EnrollTOTP(c *gin.Context)
+	ConfirmTOTP(c *gin.Context)
+	DisableTOTP(c *gin.Context)
+}
+
+type OIDCHandler interface {
+	BeginOIDCLogin(c *gin.Context)
+	CompleteOIDCLogin(c *gin.Context)
+}
+
+type AdminHandler interface {
+	ListUsers(c *gin.Context)
+	ShowUser(c *gin.Context)
+	UpdateUser(c *gin.Context)
+	ResetUserPassword(c *gin.Context)
+	RevokeUserTokens(c *gin.Context)
+	ClearLockout(c *gin.Context)
+}
+
+type PermissionsRepo interface {
+	GetAllForUser(userID int64) (permissionsModels.Permissions, error)
 }
 
-func InitRouter(engine *gin.RouterGroup, userhandler UserHandler, tokenHandler TokenHandler) {
+func InitRouter(engine *gin.RouterGroup, userhandler UserHandler, tokenHandler TokenHandler, mfaHandler MFAHandler, oidcHandler OIDCHandler, adminHandler AdminHandler, permissionsRepo PermissionsRepo) {
 	users := engine.Group("/users")
 	{
 		users.POST("", userhandler.Register)
 		users.PUT("/activated", userhandler.ActivateUser)
+		users.PUT("/password", userhandler.UpdateUserPassword)
+		users.PUT("/email", userhandler.ConfirmEmailChange)
+		users.POST("/me/totp", middlewares.RequireActivatedUser(middlewares.RequireUserCredentials(mfaHandler.EnrollTOTP)))
+		users.PUT("/me/totp", middlewares.RequireActivatedUser(middlewares.RequireUserCredentials(mfaHandler.ConfirmTOTP)))
+		users.DELETE("/me/totp", middlewares.RequireActivatedUser(middlewares.RequireUserCredentials(mfaHandler.DisableTOTP)))
+		users.GET("/me", middlewares.RequireUserCredentials(userhandler.ShowCurrentUser))
+		users.PATCH("/me", middlewares.RequireUserCredentials(userhandler.UpdateCurrentUser))
+		users.DELETE("/me", middlewares.RequireUserCredentials(userhandler.DeleteCurrentUser))
 	}
 
 	token := engine.Group("/tokens")
 	{
 		token.POST("/authentication", tokenHandler.CreateAuthenticationToken)
+		token.POST("/refresh", tokenHandler.RefreshAuthenticationToken)
+		token.POST("/mfa", tokenHandler.CreateAuthenticationTokenFromMFA)
+		token.POST("/password-reset", tokenHandler.CreatePasswordResetToken)
+		token.POST("/activation", tokenHandler.CreateActivationToken)
+		token.POST("/magic-link", tokenHandler.CreateMagicLinkToken)
+		token.POST("/magic-link/exchange", tokenHandler.ExchangeMagicLinkToken)
+		token.POST("/oidc", oidcHandler.BeginOIDCLogin)
+		token.POST("/oidc/exchange", oidcHandler.CompleteOIDCLogin)
+		token.GET("", middlewares.RequireUserCredentials(tokenHandler.ListTokens))
+		token.DELETE("/authentication", middlewares.RequireUserCredentials(tokenHandler.DeleteAuthenticationToken))
+		token.DELETE("/authentication/all", middlewares.RequireUserCredentials(tokenHandler.DeleteAllAuthenticationTokens))
+		token.DELETE("/session", tokenHandler.DeleteSession)
+	}
+
+	admin := engine.Group("/admin/users", middlewares.RequirePermission(permissionsRepo, "users:admin"))
+	{
+		admin.GET("", adminHandler.ListUsers)
+		admin.GET("/:id", adminHandler.ShowUser)
+		admin.PATCH("/:id", adminHandler.UpdateUser)
+		admin.POST("/:id/password-reset", adminHandler.ResetUserPassword)
+		admin.DELETE("/:id/tokens", adminHandler.RevokeUserTokens)
+		admin.DELETE("/:id/lockout", adminHandler.ClearLockout)
 	}
 }
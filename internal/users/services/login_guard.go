@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+)
+
+type LoginAttemptRepo interface {
+	Get(key string) (*models.LoginAttempt, error)
+	RecordFailure(key string, windowStart time.Time) (*models.LoginAttempt, error)
+	Lock(key string, until time.Time) error
+	Delete(key string) error
+}
+
+// LoginPolicy configures how failed logins of a single key are slowed down. After BackoffAfter
+// failures every attempt has to wait twice as long as the previous one, and after LockAfter
+// failures the key is locked for LockDuration. Failures older than Window are forgotten.
+type LoginPolicy struct {
+	BackoffAfter int
+	LockAfter    int
+	LockDuration time.Duration
+	Window       time.Duration
+}
+
+// LoginGuard tracks failed logins per email address and per IP, so password guesses are slowed
+// down and eventually locked out even when they are spread over many IPs. Wrong second factor
+// codes are tracked per user under MFAPolicy.
+type LoginGuard struct {
+	Repo        LoginAttemptRepo
+	EmailPolicy LoginPolicy
+	IPPolicy    LoginPolicy
+	MFAPolicy   LoginPolicy
+	Now         func() time.Time
+}
+
+func NewLoginGuard(repo LoginAttemptRepo, emailPolicy, ipPolicy, mfaPolicy LoginPolicy) *LoginGuard {
+	return &LoginGuard{
+		Repo:        repo,
+		EmailPolicy: emailPolicy,
+		IPPolicy:    ipPolicy,
+		MFAPolicy:   mfaPolicy,
+		Now:         time.Now,
+	}
+}
+
+func (g *LoginGuard) Check(email, ip string) (models.LoginDecision, error) {
+	decision, err := g.check(models.EmailLoginKey(strings.ToLower(email)), g.EmailPolicy)
+	if err != nil || !decision.Allowed {
+		return decision, err
+	}
+
+	decision, err = g.check(models.IPLoginKey(ip), g.IPPolicy)
+	// A locked IP is only throttled, it doesn't say anything about the account.
+	decision.Locked = false
+
+	return decision, err
+}
+
+// RecordFailure counts a failed login. It returns the failed logins of the account, and
+// whether this one just locked it.
+func (g *LoginGuard) RecordFailure(email, ip string) (*models.LoginAttempt, bool, error) {
+	_, _, err := g.recordFailure(models.IPLoginKey(ip), g.IPPolicy)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return g.recordFailure(models.EmailLoginKey(strings.ToLower(email)), g.EmailPolicy)
+}
+
+// RecordSuccess forgets the failed logins of an account. Failures of the IP are kept, so
+// logging into an account the attacker owns doesn't reset the count.
+func (g *LoginGuard) RecordSuccess(email string) error {
+	return g.Repo.Delete(models.EmailLoginKey(strings.ToLower(email)))
+}
+
+// Clear lifts the locks of an account, on its password as well as on its second factor
+func (g *LoginGuard) Clear(user *models.User) error {
+	err := g.Repo.Delete(models.EmailLoginKey(strings.ToLower(user.Email)))
+	if err != nil {
+		return err
+	}
+
+	return g.Repo.Delete(models.MFALoginKey(user.ID))
+}
+
+// CheckMFA tells whether a second factor code may be tried for a user
+func (g *LoginGuard) CheckMFA(userID int64) (models.LoginDecision, error) {
+	return g.check(models.MFALoginKey(userID), g.MFAPolicy)
+}
+
+// RecordMFAFailure counts a wrong second factor code. It returns the failures of the user, and
+// whether this one just locked their second factor.
+func (g *LoginGuard) RecordMFAFailure(userID int64) (*models.LoginAttempt, bool, error) {
+	return g.recordFailure(models.MFALoginKey(userID), g.MFAPolicy)
+}
+
+func (g *LoginGuard) RecordMFASuccess(userID int64) error {
+	return g.Repo.Delete(models.MFALoginKey(userID))
+}
+
+func (g *LoginGuard) check(key string, policy LoginPolicy) (models.LoginDecision, error) {
+	attempt, err := g.Repo.Get(key)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			return models.LoginDecision{Allowed: true}, nil
+		default:
+			return models.LoginDecision{}, err
+		}
+	}
+
+	now := g.Now()
+
+	if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+		return models.LoginDecision{Locked: true, RetryAfter: attempt.LockedUntil.Sub(now)}, nil
+	}
+
+	if attempt.Failures < policy.BackoffAfter || now.Sub(attempt.LastFailureAt) > policy.Window {
+		return models.LoginDecision{Allowed: true}, nil
+	}
+
+	nextAttempt := attempt.LastFailureAt.Add(backoff(attempt.Failures-policy.BackoffAfter, policy.LockDuration))
+	if now.Before(nextAttempt) {
+		return models.LoginDecision{RetryAfter: nextAttempt.Sub(now)}, nil
+	}
+
+	return models.LoginDecision{Allowed: true}, nil
+}
+
+func (g *LoginGuard) recordFailure(key string, policy LoginPolicy) (*models.LoginAttempt, bool, error) {
+	now := g.Now()
+
+	attempt, err := g.Repo.RecordFailure(key, now.Add(-policy.Window))
+	if err != nil {
+		return nil, false, err
+	}
+
+	alreadyLocked := attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil)
+	if attempt.Failures < policy.LockAfter || alreadyLocked {
+		return attempt, false, nil
+	}
+
+	lockedUntil := now.Add(policy.LockDuration)
+
+	err = g.Repo.Lock(key, lockedUntil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	attempt.LockedUntil = &lockedUntil
+
+	return attempt, true, nil
+}
+
+// backoff doubles from one second for every failure past the backoff threshold, up to max
+func backoff(failures int, max time.Duration) time.Duration {
+	if failures >= 30 {
+		return max
+	}
+
+	wait := time.Second << failures
+	if wait > max {
+		return max
+	}
+
+	return wait
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+)
+
+// fakeLoginAttemptRepo keeps attempts in memory, dating failures with the clock of now
+type fakeLoginAttemptRepo struct {
+	now      func() time.Time
+	attempts map[string]*models.LoginAttempt
+}
+
+func (r *fakeLoginAttemptRepo) Get(key string) (*models.LoginAttempt, error) {
+	attempt, ok := r.attempts[key]
+	if !ok {
+		return nil, repositoryerrors.ErrRecordNotFound
+	}
+
+	copied := *attempt
+	return &copied, nil
+}
+
+func (r *fakeLoginAttemptRepo) RecordFailure(key string, windowStart time.Time) (*models.LoginAttempt, error) {
+	attempt, ok := r.attempts[key]
+	if !ok {
+		attempt = &models.LoginAttempt{Key: key}
+		r.attempts[key] = attempt
+	}
+
+	if attempt.LastFailureAt.Before(windowStart) {
+		attempt.Failures = 0
+	}
+
+	attempt.Failures++
+	attempt.LastFailureAt = r.now()
+
+	copied := *attempt
+	return &copied, nil
+}
+
+func (r *fakeLoginAttemptRepo) Lock(key string, until time.Time) error {
+	r.attempts[key].LockedUntil = &until
+	return nil
+}
+
+func (r *fakeLoginAttemptRepo) Delete(key string) error {
+	delete(r.attempts, key)
+	return nil
+}
+
+func TestLoginGuardMFA(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	policy := LoginPolicy{BackoffAfter: 5, LockAfter: 5, LockDuration: 15 * time.Minute, Window: time.Hour}
+
+	guard := NewLoginGuard(&fakeLoginAttemptRepo{now: clock, attempts: make(map[string]*models.LoginAttempt)}, policy, policy, policy)
+	guard.Now = clock
+
+	allowed := func() bool {
+		t.Helper()
+
+		decision, err := guard.CheckMFA(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decision.Allowed
+	}
+
+	for i := 1; i < policy.LockAfter; i++ {
+		_, locked, err := guard.RecordMFAFailure(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if locked || !allowed() {
+			t.Fatalf("codes locked after %d failures, want %d", i, policy.LockAfter)
+		}
+	}
+
+	attempt, locked, err := guard.RecordMFAFailure(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked || attempt.LockedUntil == nil || !attempt.LockedUntil.Equal(now.Add(policy.LockDuration)) {
+		t.Fatalf("RecordMFAFailure = (%+v, %t), want a lock until %s", attempt, locked, now.Add(policy.LockDuration))
+	}
+
+	if allowed() {
+		t.Fatal("codes allowed while locked")
+	}
+
+	// Other users aren't affected by the lock.
+	if decision, _ := guard.CheckMFA(2); !decision.Allowed {
+		t.Error("codes of another user locked")
+	}
+
+	// Once the lock is over a single new failure locks the codes again.
+	now = now.Add(policy.LockDuration + time.Second)
+	if !allowed() {
+		t.Fatal("codes still locked after the lock duration")
+	}
+
+	if _, locked, _ := guard.RecordMFAFailure(1); !locked {
+		t.Error("failure after a lock didn't lock the codes again")
+	}
+
+	// A success forgets the failures.
+	now = now.Add(policy.LockDuration + time.Second)
+	if err := guard.RecordMFASuccess(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, locked, _ := guard.RecordMFAFailure(1); locked {
+		t.Error("failure after a success locked the codes")
+	}
+}
+
+func TestLoginGuardClear(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	policy := LoginPolicy{BackoffAfter: 1, LockAfter: 1, LockDuration: 15 * time.Minute, Window: time.Hour}
+
+	guard := NewLoginGuard(&fakeLoginAttemptRepo{now: clock, attempts: make(map[string]*models.LoginAttempt)}, policy, LoginPolicy{BackoffAfter: 100, LockAfter: 100, LockDuration: time.Minute, Window: time.Hour}, policy)
+	guard.Now = clock
+
+	user := &models.User{ID: 1, Email: "Alice@example.com"}
+
+	if _, _, err := guard.RecordFailure("alice@example.com", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := guard.RecordMFAFailure(user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := guard.Clear(user); err != nil {
+		t.Fatal(err)
+	}
+
+	if decision, _ := guard.Check(user.Email, "192.0.2.1"); !decision.Allowed {
+		t.Error("password logins still locked after Clear")
+	}
+	if decision, _ := guard.CheckMFA(user.ID); !decision.Allowed {
+		t.Error("second factor still locked after Clear")
+	}
+}
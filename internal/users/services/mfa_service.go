@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+	"greenlight/pkg/totp"
+)
+
+const recoveryCodeCount = 10
+
+type TOTPRepo interface {
+	Upsert(userID int64, secret []byte) error
+	Get(userID int64) (*models.TOTP, error)
+	Enable(userID int64, step int64, recoveryCodeHashes [][]byte) error
+	UseStep(userID int64, step int64) (bool, error)
+	UseRecoveryCode(userID int64, hash []byte) (bool, error)
+	Delete(userID int64) error
+}
+
+type MFAService struct {
+	TOTPRepo TOTPRepo
+	Issuer   string
+	// Now is the clock codes are checked against, replaceable so codes can be checked offline
+	Now func() time.Time
+}
+
+func NewMFAService(totpRepo TOTPRepo, issuer string) *MFAService {
+	return &MFAService{
+		TOTPRepo: totpRepo,
+		Issuer:   issuer,
+		Now:      time.Now,
+	}
+}
+
+// Enroll generates a new TOTP secret for user. Two-factor authentication is only turned on once
+// a first code is confirmed with Confirm.
+func (s *MFAService) Enroll(user *models.User) (*models.TOTPEnrollment, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.TOTPRepo.Upsert(user.ID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TOTPEnrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.URI(s.Issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm turns on two-factor authentication when code matches the enrolled secret, and returns
+// the recovery codes. Only their hashes are stored, so they can't be shown again.
+func (s *MFAService) Confirm(userID int64, code string) ([]string, bool, error) {
+	enrollment, err := s.TOTPRepo.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			return nil, false, models.ErrTOTPNotEnrolled
+		default:
+			return nil, false, err
+		}
+	}
+
+	if enrollment.Enabled {
+		return nil, false, models.ErrTOTPAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(enrollment.Secret, code, s.Now(), 1)
+	if !ok {
+		return nil, false, nil
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+
+	for i := range codes {
+		codes[i], err = models.GenerateRecoveryCode()
+		if err != nil {
+			return nil, false, err
+		}
+		hashes[i] = models.HashRecoveryCode(codes[i])
+	}
+
+	err = s.TOTPRepo.Enable(userID, step, hashes)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return codes, true, nil
+}
+
+func (s *MFAService) Enabled(userID int64) (bool, error) {
+	enrollment, err := s.TOTPRepo.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return enrollment.Enabled, nil
+}
+
+// Verify checks a TOTP code, or a recovery code when code isn't one, for a user with two-factor
+// authentication enabled. Each TOTP step and recovery code is only accepted once.
+func (s *MFAService) Verify(userID int64, code string) (bool, error) {
+	enrollment, err := s.TOTPRepo.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			return false, models.ErrTOTPNotEnrolled
+		default:
+			return false, err
+		}
+	}
+
+	if !enrollment.Enabled {
+		return false, models.ErrTOTPNotEnrolled
+	}
+
+	if step, ok := totp.Validate(enrollment.Secret, code, s.Now(), 1); ok {
+		return s.TOTPRepo.UseStep(userID, step)
+	}
+
+	return s.TOTPRepo.UseRecoveryCode(userID, models.HashRecoveryCode(code))
+}
+
+// Disable turns off two-factor authentication once code is verified
+func (s *MFAService) Disable(userID int64, code string) (bool, error) {
+	ok, err := s.Verify(userID, code)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, s.TOTPRepo.Delete(userID)
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+	"greenlight/pkg/totp"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// wrongCode returns a code that isn't valid for secret at now, whatever the secret is
+func wrongCode(secret []byte, now time.Time) string {
+	for i := 0; ; i++ {
+		code := fmt.Sprintf("%06d", i)
+		if _, ok := totp.Validate(secret, code, now, 1); !ok {
+			return code
+		}
+	}
+}
+
+// fakeTOTPRepo keeps enrollments in memory, with the replay rules of TOTPRepo
+type fakeTOTPRepo struct {
+	enrollments   map[int64]*models.TOTP
+	recoveryCodes map[int64][][]byte
+}
+
+func newFakeTOTPRepo() *fakeTOTPRepo {
+	return &fakeTOTPRepo{
+		enrollments:   make(map[int64]*models.TOTP),
+		recoveryCodes: make(map[int64][][]byte),
+	}
+}
+
+func (r *fakeTOTPRepo) Upsert(userID int64, secret []byte) error {
+	r.enrollments[userID] = &models.TOTP{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (r *fakeTOTPRepo) Get(userID int64) (*models.TOTP, error) {
+	enrollment, ok := r.enrollments[userID]
+	if !ok {
+		return nil, repositoryerrors.ErrRecordNotFound
+	}
+
+	copied := *enrollment
+	return &copied, nil
+}
+
+func (r *fakeTOTPRepo) Enable(userID int64, step int64, recoveryCodeHashes [][]byte) error {
+	r.enrollments[userID].Enabled = true
+	r.enrollments[userID].LastUsedStep = step
+	r.recoveryCodes[userID] = recoveryCodeHashes
+	return nil
+}
+
+func (r *fakeTOTPRepo) UseStep(userID int64, step int64) (bool, error) {
+	enrollment := r.enrollments[userID]
+	if enrollment.LastUsedStep >= step {
+		return false, nil
+	}
+
+	enrollment.LastUsedStep = step
+	return true, nil
+}
+
+func (r *fakeTOTPRepo) UseRecoveryCode(userID int64, hash []byte) (bool, error) {
+	hashes := r.recoveryCodes[userID]
+
+	for i, stored := range hashes {
+		if bytes.Equal(stored, hash) {
+			r.recoveryCodes[userID] = append(hashes[:i:i], hashes[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *fakeTOTPRepo) Delete(userID int64) error {
+	delete(r.enrollments, userID)
+	delete(r.recoveryCodes, userID)
+	return nil
+}
+
+// enrolledMFAService returns a service whose clock is read from now, with two-factor
+// authentication enabled for user 1, and the recovery codes it got
+func enrolledMFAService(t *testing.T, now *time.Time) (*MFAService, []byte, []string) {
+	t.Helper()
+
+	service := NewMFAService(newFakeTOTPRepo(), "Greenlight")
+	service.Now = func() time.Time { return *now }
+
+	user := &models.User{ID: 1, Email: "alice@example.com"}
+
+	enrollment, err := service.Enroll(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes, ok, err := service.Confirm(user.ID, totp.Code(secret, totp.Step(*now)))
+	if err != nil || !ok {
+		t.Fatalf("Confirm = (%t, %v), want (true, nil)", ok, err)
+	}
+
+	return service, secret, codes
+}
+
+func TestMFAServiceConfirm(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	service := NewMFAService(newFakeTOTPRepo(), "Greenlight")
+	service.Now = func() time.Time { return now }
+
+	if _, _, err := service.Confirm(1, "123456"); err != models.ErrTOTPNotEnrolled {
+		t.Fatalf("Confirm before Enroll: err = %v, want %v", err, models.ErrTOTPNotEnrolled)
+	}
+
+	enrollment, err := service.Enroll(&models.User{ID: 1, Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A code from a minute ago is outside the allowed skew.
+	stale := totp.Code(secret, totp.Step(now.Add(-time.Minute)))
+	if _, ok, err := service.Confirm(1, stale); ok || err != nil {
+		t.Fatalf("Confirm with a stale code = (%t, %v), want (false, nil)", ok, err)
+	}
+
+	if enabled, _ := service.Enabled(1); enabled {
+		t.Fatal("two-factor authentication enabled by a rejected code")
+	}
+
+	codes, ok, err := service.Confirm(1, totp.Code(secret, totp.Step(now)))
+	if err != nil || !ok {
+		t.Fatalf("Confirm = (%t, %v), want (true, nil)", ok, err)
+	}
+
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	if enabled, _ := service.Enabled(1); !enabled {
+		t.Error("two-factor authentication not enabled after Confirm")
+	}
+
+	if _, _, err := service.Confirm(1, totp.Code(secret, totp.Step(now))); err != models.ErrTOTPAlreadyEnabled {
+		t.Errorf("second Confirm: err = %v, want %v", err, models.ErrTOTPAlreadyEnabled)
+	}
+}
+
+func TestMFAServiceVerifyTOTP(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	service, secret, _ := enrolledMFAService(t, &now)
+
+	verify := func(code string, want bool) {
+		t.Helper()
+
+		ok, err := service.Verify(1, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != want {
+			t.Errorf("Verify(%q) at %s = %t, want %t", code, now.Format(time.TimeOnly), ok, want)
+		}
+	}
+
+	// The code used to confirm the enrollment can't be replayed.
+	verify(totp.Code(secret, totp.Step(now)), false)
+
+	now = now.Add(totp.Period)
+	current := totp.Code(secret, totp.Step(now))
+	verify(current, true)
+	verify(current, false)
+
+	// Codes of earlier steps are refused once a later one was used, even within the skew.
+	verify(totp.Code(secret, totp.Step(now)-1), false)
+
+	// One step of clock drift is allowed either way.
+	now = now.Add(3 * totp.Period)
+	verify(totp.Code(secret, totp.Step(now)+1), true)
+
+	now = now.Add(5 * totp.Period)
+	verify(totp.Code(secret, totp.Step(now)-2), false)
+	verify(totp.Code(secret, totp.Step(now)-1), true)
+}
+
+func TestMFAServiceVerifyRecoveryCode(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	service, _, codes := enrolledMFAService(t, &now)
+
+	ok, err := service.Verify(1, codes[0])
+	if err != nil || !ok {
+		t.Fatalf("Verify with a recovery code = (%t, %v), want (true, nil)", ok, err)
+	}
+
+	ok, err = service.Verify(1, codes[0])
+	if err != nil || ok {
+		t.Fatalf("Verify with a used recovery code = (%t, %v), want (false, nil)", ok, err)
+	}
+
+	// Recovery codes are accepted regardless of case and of the dash.
+	typed := strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))
+
+	ok, err = service.Verify(1, typed)
+	if err != nil || !ok {
+		t.Fatalf("Verify(%q) = (%t, %v), want (true, nil)", typed, ok, err)
+	}
+
+	ok, err = service.Verify(1, "aaaaa-aaaaa")
+	if err != nil || ok {
+		t.Fatalf("Verify with an unknown recovery code = (%t, %v), want (false, nil)", ok, err)
+	}
+}
+
+func TestMFAServiceDisable(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	service, secret, _ := enrolledMFAService(t, &now)
+
+	if ok, err := service.Disable(1, wrongCode(secret, now)); ok || err != nil {
+		t.Fatalf("Disable with a wrong code = (%t, %v), want (false, nil)", ok, err)
+	}
+
+	now = now.Add(totp.Period)
+
+	if ok, err := service.Disable(1, totp.Code(secret, totp.Step(now))); !ok || err != nil {
+		t.Fatalf("Disable = (%t, %v), want (true, nil)", ok, err)
+	}
+
+	if enabled, _ := service.Enabled(1); enabled {
+		t.Error("two-factor authentication still enabled after Disable")
+	}
+
+	if _, err := service.Verify(1, "000000"); err != models.ErrTOTPNotEnrolled {
+		t.Errorf("Verify after Disable: err = %v, want %v", err, models.ErrTOTPNotEnrolled)
+	}
+}
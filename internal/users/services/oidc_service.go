@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+	"greenlight/pkg/oidc"
+)
+
+type IdentityRepo interface {
+	Insert(identity *models.Identity) error
+	GetUser(ctx context.Context, provider, subject string) (*models.User, error)
+	InsertState(state string, oidcState *models.OIDCState) error
+	RedeemState(state string) (*models.OIDCState, error)
+}
+
+// MFAChecker tells whether a user has two-factor authentication on, MFAService does
+type MFAChecker interface {
+	Enabled(userID int64) (bool, error)
+}
+
+// PermissionGranter grants permission codes to users, the permissions repository does
+type PermissionGranter interface {
+	AddForUser(userID int64, codes ...string) error
+}
+
+type OIDCProvider interface {
+	AuthCodeURL(state, nonce, verifier string) string
+	Exchange(ctx context.Context, code, verifier, nonce string) (*oidc.Claims, error)
+}
+
+// OIDCService signs users in through an OpenID Connect provider. Identities are keyed by
+// ProviderName, the issuer, and the subject the provider knows the user by. Users it creates get
+// DefaultRole, like every new user, and DefaultPermissions on top of it.
+type OIDCService struct {
+	UserRepo           UserRepo
+	IdentityRepo       IdentityRepo
+	RoleRepo           RoleRepo
+	PermissionsRepo    PermissionGranter
+	MFA                MFAChecker
+	Provider           OIDCProvider
+	ProviderName       string
+	DefaultRole        string
+	DefaultPermissions []string
+}
+
+func NewOIDCService(userRepo UserRepo, identityRepo IdentityRepo, roleRepo RoleRepo, permissionsRepo PermissionGranter, mfa MFAChecker, provider OIDCProvider, providerName string, defaultRole string, defaultPermissions []string) *OIDCService {
+	return &OIDCService{
+		UserRepo:           userRepo,
+		IdentityRepo:       identityRepo,
+		RoleRepo:           roleRepo,
+		PermissionsRepo:    permissionsRepo,
+		MFA:                mfa,
+		Provider:           provider,
+		ProviderName:       providerName,
+		DefaultRole:        defaultRole,
+		DefaultPermissions: defaultPermissions,
+	}
+}
+
+// BeginLogin returns the provider URL the user has to sign in at. The state, nonce and PKCE
+// verifier are kept for ten minutes.
+func (s *OIDCService) BeginLogin() (string, error) {
+	var values [3]string
+
+	for i := range values {
+		value, err := oidc.NewRandom()
+		if err != nil {
+			return "", err
+		}
+		values[i] = value
+	}
+
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	err := s.IdentityRepo.InsertState(state, &models.OIDCState{
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Expiry:       time.Now().Add(10 * time.Minute),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return s.Provider.AuthCodeURL(state, nonce, verifier), nil
+}
+
+// CompleteLogin exchanges the authorization code the provider sent back with state, and returns
+// the user it belongs to. On their first login users are linked to the local account with the
+// same, verified, email address, or a new activated account is created for them. Accounts with
+// two-factor authentication are never linked that way, whoever controls the address at the
+// provider would otherwise get past the account's second factor setup.
+func (s *OIDCService) CompleteLogin(ctx context.Context, state, code string) (*models.User, error) {
+	oidcState, err := s.IdentityRepo.RedeemState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := s.Provider.Exchange(ctx, code, oidcState.CodeVerifier, oidcState.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.IdentityRepo.GetUser(ctx, s.ProviderName, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, repositoryerrors.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Linking by email is only safe when the provider vouches for the address.
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, models.ErrEmailNotVerified
+	}
+
+	user, err = s.UserRepo.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		mfaEnabled, err := s.MFA.Enabled(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if mfaEnabled {
+			return nil, models.ErrMFALinkRefused
+		}
+
+		if !user.Activated {
+			user.Activated = true
+
+			err = s.UserRepo.Update(ctx, user)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+		user, err = s.createUser(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	// Should linking fail, the next login links the account by email again.
+	err = s.IdentityRepo.Insert(&models.Identity{
+		Provider: s.ProviderName,
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *OIDCService) createUser(ctx context.Context, claims *oidc.Claims) (*models.User, error) {
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+
+	user := &models.User{
+		Name:      name,
+		Email:     claims.Email,
+		Activated: true,
+	}
+
+	// The user signs in through the provider, the random password only fills the column until
+	// they choose one through a password reset.
+	password, err := models.GenerateRandomPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.UserRepo.Insert(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.RoleRepo.AddForUser(user.ID, s.DefaultRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.DefaultPermissions) > 0 {
+		err = s.PermissionsRepo.AddForUser(user.ID, s.DefaultPermissions...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
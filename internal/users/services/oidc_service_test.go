@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+	"greenlight/pkg/oidc"
+)
+
+// fakeUserRepo keeps users in memory, keyed by email address
+type fakeUserRepo struct {
+	users map[string]*models.User
+}
+
+func (r *fakeUserRepo) Insert(ctx context.Context, user *models.User) error {
+	user.ID = int64(len(r.users) + 1)
+	r.users[user.Email] = user
+	return nil
+}
+
+func (r *fakeUserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, ok := r.users[email]
+	if !ok {
+		return nil, repositoryerrors.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+func (r *fakeUserRepo) GetByID(ctx context.Context, id int64) (*models.User, error) {
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, repositoryerrors.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) Update(ctx context.Context, user *models.User) error {
+	r.users[user.Email] = user
+	return nil
+}
+
+func (r *fakeUserRepo) Delete(ctx context.Context, id int64) error {
+	return errors.New("not implemented")
+}
+
+func (r *fakeUserRepo) GetForToken(tokenScope, tokenPlaintext string) (*models.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+// fakeIdentityRepo keeps identities and login states in memory, states can be redeemed once
+type fakeIdentityRepo struct {
+	identities map[string]int64
+	states     map[string]*models.OIDCState
+	users      *fakeUserRepo
+}
+
+func (r *fakeIdentityRepo) Insert(identity *models.Identity) error {
+	r.identities[identity.Provider+" "+identity.Subject] = identity.UserID
+	return nil
+}
+
+func (r *fakeIdentityRepo) GetUser(ctx context.Context, provider, subject string) (*models.User, error) {
+	userID, ok := r.identities[provider+" "+subject]
+	if !ok {
+		return nil, repositoryerrors.ErrRecordNotFound
+	}
+	return r.users.GetByID(ctx, userID)
+}
+
+func (r *fakeIdentityRepo) InsertState(state string, oidcState *models.OIDCState) error {
+	r.states[state] = oidcState
+	return nil
+}
+
+func (r *fakeIdentityRepo) RedeemState(state string) (*models.OIDCState, error) {
+	oidcState, ok := r.states[state]
+	if !ok {
+		return nil, repositoryerrors.ErrRecordNotFound
+	}
+	delete(r.states, state)
+	return oidcState, nil
+}
+
+type fakeRoleRepo struct{}
+
+func (fakeRoleRepo) AddForUser(userID int64, names ...string) error {
+	return nil
+}
+
+type fakeMFAChecker map[int64]bool
+
+func (m fakeMFAChecker) Enabled(userID int64) (bool, error) {
+	return m[userID], nil
+}
+
+// fakeOIDCProvider answers every exchange with claims, once the code verifier and nonce of the
+// login state are the ones it handed out
+type fakeOIDCProvider struct {
+	claims   oidc.Claims
+	verifier string
+	nonce    string
+}
+
+func (p *fakeOIDCProvider) AuthCodeURL(state, nonce, verifier string) string {
+	p.verifier, p.nonce = verifier, nonce
+	return "https://provider.test/authorize?state=" + state
+}
+
+func (p *fakeOIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*oidc.Claims, error) {
+	if verifier != p.verifier || nonce != p.nonce {
+		return nil, oidc.ErrExchangeFailed
+	}
+
+	claims := p.claims
+	return &claims, nil
+}
+
+func newTestOIDCService(mfa fakeMFAChecker, users ...*models.User) (*OIDCService, *fakeIdentityRepo) {
+	userRepo := &fakeUserRepo{users: make(map[string]*models.User)}
+	for _, user := range users {
+		userRepo.users[user.Email] = user
+	}
+
+	identityRepo := &fakeIdentityRepo{
+		identities: make(map[string]int64),
+		states:     make(map[string]*models.OIDCState),
+		users:      userRepo,
+	}
+
+	provider := &fakeOIDCProvider{claims: oidc.Claims{Subject: "subject-1", Email: "alice@example.com", EmailVerified: true}}
+
+	return NewOIDCService(userRepo, identityRepo, fakeRoleRepo{}, nil, mfa, provider, "https://provider.test", "user", nil), identityRepo
+}
+
+// beginLogin starts a login and returns its state
+func beginLogin(t *testing.T, s *OIDCService, identityRepo *fakeIdentityRepo) string {
+	t.Helper()
+
+	_, err := s.BeginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for state := range identityRepo.states {
+		return state
+	}
+
+	t.Fatal("no login state stored")
+	return ""
+}
+
+func TestOIDCCompleteLoginState(t *testing.T) {
+	s, identityRepo := newTestOIDCService(fakeMFAChecker{})
+
+	state := beginLogin(t, s, identityRepo)
+
+	_, err := s.CompleteLogin(context.Background(), "unknown-state", "code")
+	if !errors.Is(err, repositoryerrors.ErrRecordNotFound) {
+		t.Errorf("unknown state: got %v, want ErrRecordNotFound", err)
+	}
+
+	user, err := s.CompleteLogin(context.Background(), state, "code")
+	if err != nil {
+		t.Fatalf("stored state: %v", err)
+	}
+	if user.Email != "alice@example.com" || !user.Activated {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	// States are single use, a replayed callback is refused.
+	_, err = s.CompleteLogin(context.Background(), state, "code")
+	if !errors.Is(err, repositoryerrors.ErrRecordNotFound) {
+		t.Errorf("replayed state: got %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestOIDCCompleteLoginLinksByEmail(t *testing.T) {
+	alice := &models.User{ID: 7, Email: "alice@example.com", Activated: true}
+
+	s, identityRepo := newTestOIDCService(fakeMFAChecker{}, alice)
+
+	user, err := s.CompleteLogin(context.Background(), beginLogin(t, s, identityRepo), "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != alice.ID {
+		t.Errorf("got user %d, want the existing account %d", user.ID, alice.ID)
+	}
+	if identityRepo.identities["https://provider.test subject-1"] != alice.ID {
+		t.Error("the identity wasn't linked to the existing account")
+	}
+}
+
+func TestOIDCCompleteLoginRefusesLinkingMFAAccounts(t *testing.T) {
+	alice := &models.User{ID: 7, Email: "alice@example.com", Activated: true}
+
+	s, identityRepo := newTestOIDCService(fakeMFAChecker{alice.ID: true}, alice)
+
+	_, err := s.CompleteLogin(context.Background(), beginLogin(t, s, identityRepo), "code")
+	if !errors.Is(err, models.ErrMFALinkRefused) {
+		t.Errorf("got %v, want ErrMFALinkRefused", err)
+	}
+	if len(identityRepo.identities) != 0 {
+		t.Error("an identity was linked to the account")
+	}
+}
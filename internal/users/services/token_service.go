@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/users/models"
+	"greenlight/pkg/signedtoken"
+)
+
+type TokenService struct {
+	UserRepo        UserRepo
+	TokenRepo       TokenRepo
+	PermissionsRepo PermissionsRepo
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Authority is set when authentication tokens are issued as signed tokens instead of opaque ones
+	Authority *signedtoken.Authority
+}
+
+func NewTokenService(userRepo UserRepo, tokenRepo TokenRepo, permissionsRepo PermissionsRepo, accessTokenTTL, refreshTokenTTL time.Duration, authority *signedtoken.Authority) *TokenService {
+	return &TokenService{
+		UserRepo:        userRepo,
+		TokenRepo:       tokenRepo,
+		PermissionsRepo: permissionsRepo,
+		AccessTokenTTL:  accessTokenTTL,
+		RefreshTokenTTL: refreshTokenTTL,
+		Authority:       authority,
+	}
+}
+
+// IssueAuthenticationTokens starts a new token family for user, made of a short-lived
+// authentication token and the refresh token used to renew it.
+func (s *TokenService) IssueAuthenticationTokens(user *models.User) (*models.AuthenticationTokens, error) {
+	family := make([]byte, 16)
+
+	_, err := rand.Read(family)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueInFamily(user, family)
+}
+
+// RefreshAuthenticationTokens swaps a refresh token for a new pair in the same family. Refresh
+// tokens can only be used once: presenting one again revokes its whole family and returns
+// models.ErrRefreshTokenReused.
+func (s *TokenService) RefreshAuthenticationTokens(refreshTokenPlaintext string) (*models.AuthenticationTokens, error) {
+	token, err := s.TokenRepo.GetForPlaintext(models.ScopeRefresh, refreshTokenPlaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	consumed := false
+	if token.UsedAt == nil {
+		consumed, err = s.TokenRepo.Consume(token.Hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !consumed {
+		err = s.TokenRepo.DeleteFamily(token.Family)
+		if err != nil {
+			return nil, err
+		}
+		return nil, models.ErrRefreshTokenReused
+	}
+
+	user, err := s.UserRepo.GetByID(context.Background(), token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Suspended {
+		return nil, models.ErrAccountSuspended
+	}
+
+	return s.issueInFamily(user, token.Family)
+}
+
+// RevokeAuthenticationToken revokes an authentication token together with its family, so the
+// refresh token that goes with it can't be used to get a new one.
+func (s *TokenService) RevokeAuthenticationToken(tokenPlaintext string) error {
+	if s.Authority != nil && signedtoken.IsSigned(tokenPlaintext) {
+		return s.revokeSignedToken(tokenPlaintext)
+	}
+
+	token, err := s.TokenRepo.GetForPlaintext(models.ScopeAuthentication, tokenPlaintext)
+	if err != nil {
+		return err
+	}
+
+	if token.Family == nil {
+		return s.TokenRepo.Delete(models.ScopeAuthentication, tokenPlaintext)
+	}
+
+	return s.TokenRepo.DeleteFamily(token.Family)
+}
+
+// RevokeAllAuthenticationTokens signs a user out of every session. Signed access tokens aren't
+// stored, they are cut off through the denylist instead.
+func (s *TokenService) RevokeAllAuthenticationTokens(userID int64) error {
+	for _, scope := range []string{models.ScopeAuthentication, models.ScopeRefresh} {
+		err := s.TokenRepo.DeleteAllForUser(scope, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.RevokeAccessTokens(userID)
+}
+
+// RevokeOtherAuthenticationTokens signs a user out of every session but the one of currentToken.
+// A signed currentToken is cut off with the others, the refresh token of its family is kept so
+// the session carries on with a new access token.
+func (s *TokenService) RevokeOtherAuthenticationTokens(userID int64, currentToken string) error {
+	family := s.Family(currentToken)
+
+	for _, scope := range []string{models.ScopeAuthentication, models.ScopeRefresh} {
+		var err error
+		if family != nil {
+			err = s.TokenRepo.DeleteAllForUserExceptFamily(scope, userID, family)
+		} else {
+			err = s.TokenRepo.DeleteAllForUserExcept(scope, userID, currentToken)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.RevokeAccessTokens(userID)
+}
+
+// RevokeAccessTokens cuts off the signed access tokens issued to a user so far, for changes that
+// make their claims stale. Refresh tokens stay valid, the next refresh issues up to date claims.
+// Opaque tokens are checked against the database on every request and need no revocation.
+func (s *TokenService) RevokeAccessTokens(userID int64) error {
+	if s.Authority == nil {
+		return nil
+	}
+
+	return s.Authority.RevokeUser(userID, s.AccessTokenTTL)
+}
+
+// RevokeEveryAccessToken cuts off the signed access tokens of every user, for changes such as
+// the permissions of a role that may affect any of them
+func (s *TokenService) RevokeEveryAccessToken() error {
+	return s.RevokeAccessTokens(signedtoken.AllUsers)
+}
+
+// Family returns the token family of a signed token, and nil for opaque or invalid ones
+func (s *TokenService) Family(tokenPlaintext string) []byte {
+	if s.Authority == nil || !signedtoken.IsSigned(tokenPlaintext) {
+		return nil
+	}
+
+	claims, err := s.Authority.Verify(tokenPlaintext)
+	if err != nil {
+		return nil
+	}
+
+	family, err := base64.RawURLEncoding.DecodeString(claims.Family)
+	if err != nil || len(family) == 0 {
+		return nil
+	}
+
+	return family
+}
+
+// revokeSignedToken denies a signed token until it expires, and deletes the refresh tokens of
+// its family so it can't be renewed.
+func (s *TokenService) revokeSignedToken(tokenPlaintext string) error {
+	claims, err := s.Authority.Verify(tokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, signedtoken.ErrRevokedToken), errors.Is(err, signedtoken.ErrExpiredToken):
+			return nil
+		default:
+			return repositoryerrors.ErrRecordNotFound
+		}
+	}
+
+	err = s.Authority.Revoke(claims)
+	if err != nil {
+		return err
+	}
+
+	family, err := base64.RawURLEncoding.DecodeString(claims.Family)
+	if err != nil || len(family) == 0 {
+		return err
+	}
+
+	return s.TokenRepo.DeleteFamily(family)
+}
+
+func (s *TokenService) issueInFamily(user *models.User, family []byte) (*models.AuthenticationTokens, error) {
+	access, err := s.newAccessToken(user, family)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := models.GenerateToken(user.ID, s.RefreshTokenTTL, models.ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	refresh.Family = family
+
+	err = s.TokenRepo.Insert(refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthenticationTokens{Access: access, Refresh: refresh}, nil
+}
+
+// newAccessToken returns a signed token carrying the user's activation state and permissions
+// when an Authority is configured, and otherwise stores a new opaque token.
+func (s *TokenService) newAccessToken(user *models.User, family []byte) (*models.Token, error) {
+	if s.Authority == nil {
+		access, err := models.GenerateToken(user.ID, s.AccessTokenTTL, models.ScopeAuthentication)
+		if err != nil {
+			return nil, err
+		}
+		access.Family = family
+
+		err = s.TokenRepo.Insert(access)
+		if err != nil {
+			return nil, err
+		}
+
+		return access, nil
+	}
+
+	permissions, err := s.PermissionsRepo.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &signedtoken.Claims{
+		Subject:     user.ID,
+		Activated:   user.Activated,
+		Permissions: permissions,
+		Family:      base64.RawURLEncoding.EncodeToString(family),
+	}
+
+	plaintext, err := s.Authority.Issue(claims, s.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Token{
+		Plaintext: plaintext,
+		UserID:    user.ID,
+		Expiry:    claims.Expiry(),
+		Scope:     models.ScopeAuthentication,
+		Family:    family,
+	}, nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"time"
 
+	permissionsModels "greenlight/internal/permissions/models"
 	"greenlight/internal/repositoryerrors"
 	"greenlight/internal/users/models"
 	"greenlight/pkg/mailer"
@@ -20,35 +21,60 @@ type Logger interface {
 type UserRepo interface {
 	Insert(context.Context, *models.User) error
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetByID(ctx context.Context, id int64) (*models.User, error)
 	Update(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, id int64) error
 	GetForToken(tokenScope, tokenPlaintext string) (*models.User, error)
 }
 
 type TokenRepo interface {
 	New(userID int64, ttl time.Duration, scope string) (*models.Token, error)
 	Insert(token *models.Token) error
+	GetForPlaintext(scope, tokenPlaintext string) (*models.Token, error)
+	Delete(scope, tokenPlaintext string) error
 	DeleteAllForUser(scope string, userID int64) error
+	DeleteAllForUserExcept(scope string, userID int64, tokenPlaintext string) error
+	DeleteAllForUserExceptFamily(scope string, userID int64, family []byte) error
+	Consume(hash []byte) (bool, error)
+	DeleteFamily(family []byte) error
 }
 
 type PermissionsRepo interface {
-	AddForUser(userID int64, codes ...string) error
+	GetAllForUser(userID int64) (permissionsModels.Permissions, error)
 }
 
+type RoleRepo interface {
+	AddForUser(userID int64, names ...string) error
+}
+
+type APIKeyRepo interface {
+	DeleteAllForUser(userID int64) error
+}
+
+// UserService registers and manages users. New users get DefaultRole. Sessions are revoked
+// through TokenService, which also cuts off signed access tokens, and password resets delete the
+// user's API keys.
 type UserService struct {
-	UserRepo        UserRepo
-	TokenRepo       TokenRepo
-	PermissionsRepo PermissionsRepo
-	Logger          Logger
-	Mailer          mailer.Mailer
+	UserRepo     UserRepo
+	TokenRepo    TokenRepo
+	RoleRepo     RoleRepo
+	APIKeyRepo   APIKeyRepo
+	TokenService *TokenService
+	DefaultRole  string
+	Logger       Logger
+	Mailer       mailer.Mailer
 }
 
-func NewUserService(userRepo UserRepo, tokenRepo TokenRepo, permissionsRepo PermissionsRepo, logger Logger, mailer mailer.Mailer) *UserService {
+func NewUserService(userRepo UserRepo, tokenRepo TokenRepo, roleRepo RoleRepo, apiKeyRepo APIKeyRepo, tokenService *TokenService, defaultRole string, logger Logger, mailer mailer.Mailer) *UserService {
 	return &UserService{
-		UserRepo:        userRepo,
-		TokenRepo:       tokenRepo,
-		PermissionsRepo: permissionsRepo,
-		Logger:          logger,
-		Mailer:          mailer,
+		UserRepo:     userRepo,
+		TokenRepo:    tokenRepo,
+		RoleRepo:     roleRepo,
+		APIKeyRepo:   apiKeyRepo,
+		TokenService: tokenService,
+		DefaultRole:  defaultRole,
+		Logger:       logger,
+		Mailer:       mailer,
 	}
 }
 
@@ -63,49 +89,295 @@ func (s *UserService) RegisterUser(context context.Context, user models.User) (*
 		}
 	}
 
-	err = s.PermissionsRepo.AddForUser(user.ID, "movies:read")
+	err = s.RoleRepo.AddForUser(user.ID, s.DefaultRole)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.TokenRepo.New(user.ID, 24*3*time.Hour, models.ScopeActivation)
 	if err != nil {
 		return nil, err
 	}
 
+	s.sendEmail(user.Email, "user_welcome.tmpl", map[string]any{
+		"activationToken": token.Plaintext,
+		"userID":          user.ID,
+	})
+
+	return &user, nil
+}
+
+// ResendActivation replaces the activation tokens of a not yet activated user with a new one
+// and mails it. Unknown and already activated addresses are silently ignored.
+func (s *UserService) ResendActivation(context context.Context, email string) error {
+	user, err := s.UserRepo.GetByEmail(context, email)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if user.Activated {
+		return nil
+	}
+
+	err = s.TokenRepo.DeleteAllForUser(models.ScopeActivation, user.ID)
+	if err != nil {
+		return err
+	}
+
 	token, err := s.TokenRepo.New(user.ID, 24*3*time.Hour, models.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	s.sendEmail(user.Email, "token_activation.tmpl", map[string]any{
+		"activationToken": token.Plaintext,
+	})
+
+	return nil
+}
+
+func (s *UserService) ActivateUser(context context.Context, tokenPlainText string) (*models.User, error) {
+	user, err := s.UserRepo.GetForToken(models.ScopeActivation, tokenPlainText)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Activated = true
+
+	err = s.UserRepo.Update(context, user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.TokenRepo.DeleteAllForUser(models.ScopeActivation, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ResetPassword sets a new password for the owner of a password-reset token, signs them out of
+// all sessions and deletes their API keys and pending tokens, see deletePendingTokens.
+func (s *UserService) ResetPassword(context context.Context, tokenPlaintext, password string) (*models.User, error) {
+	user, err := s.UserRepo.GetForToken(models.ScopePasswordReset, tokenPlaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.UserRepo.Update(context, user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.deletePendingTokens(user.ID)
 	if err != nil {
 		return nil, err
 	}
 
+	err = s.APIKeyRepo.DeleteAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.TokenService.RevokeAllAuthenticationTokens(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// RequestPasswordReset mails user a password-reset token valid for 45 minutes
+func (s *UserService) RequestPasswordReset(user *models.User) error {
+	token, err := s.TokenRepo.New(user.ID, 45*time.Minute, models.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	s.sendEmail(user.Email, "token_password_reset.tmpl", map[string]any{
+		"passwordResetToken": token.Plaintext,
+	})
+
+	return nil
+}
+
+// ForcePasswordReset replaces the password of user with a random one, signs them out of every
+// session and mails them a password-reset token, so a compromised password stops working at once.
+// Every other way in is closed as well: API keys, pending login links, second factor steps and
+// email changes.
+func (s *UserService) ForcePasswordReset(context context.Context, user *models.User) error {
+	password, err := models.GenerateRandomPassword()
+	if err != nil {
+		return err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return err
+	}
+
+	err = s.UserRepo.Update(context, user)
+	if err != nil {
+		return err
+	}
+
+	err = s.deletePendingTokens(user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.APIKeyRepo.DeleteAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.TokenService.RevokeAllAuthenticationTokens(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.RequestPasswordReset(user)
+}
+
+func (s *UserService) sendEmail(recipient, templateFile string, data map[string]any) {
 	go func() {
 		taskutils.BackgroundTask(s.Logger, func() {
-			data := map[string]any{
-				"activationToken": token.Plaintext,
-				"userID":          user.ID,
-			}
-			err = s.Mailer.Send(user.Email, "user_welcome.tmpl", data)
+			err := s.Mailer.Send(recipient, templateFile, data)
 			if err != nil {
 				s.Logger.PrintError(err, nil)
 			}
 		})
 	}()
+}
 
-	return &user, nil
+// UpdateUser saves changes a user made to their own account. When the password was changed,
+// every other session of the user is revoked, keeping only the family of currentToken alive, and
+// their pending tokens are deleted.
+func (s *UserService) UpdateUser(context context.Context, user *models.User, currentToken string) error {
+	err := s.UserRepo.Update(context, user)
+	if err != nil {
+		return err
+	}
+
+	if user.Password.Plaintext == nil {
+		return nil
+	}
+
+	err = s.deletePendingTokens(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.TokenService.RevokeOtherAuthenticationTokens(user.ID, currentToken)
 }
 
-func (s *UserService) ActivateUser(context context.Context, tokenPlainText string) (*models.User, error) {
-	user, err := s.UserRepo.GetForToken(models.ScopeActivation, tokenPlainText)
+// deletePendingTokens deletes the tokens that stand in for the password when it changes: password
+// resets, login links, second factor steps and email changes. An email change requested by
+// whoever knew the old password could otherwise still be confirmed, and the account taken over
+// through a password reset to the new address.
+func (s *UserService) deletePendingTokens(userID int64) error {
+	for _, scope := range []string{models.ScopePasswordReset, models.ScopeMagicLink, models.ScopeMFAPending, models.ScopeEmailChange} {
+		err := s.TokenRepo.DeleteAllForUser(scope, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckEmailAvailable returns ErrDuplicateEmail when another account already uses email
+func (s *UserService) CheckEmailAvailable(context context.Context, email string) error {
+	_, err := s.UserRepo.GetByEmail(context, email)
+	switch {
+	case err == nil:
+		return repositoryerrors.ErrDuplicateEmail
+	case !errors.Is(err, repositoryerrors.ErrRecordNotFound):
+		return err
+	}
+
+	return nil
+}
+
+// RequestEmailChange stores newEmail next to an email-change token and mails a confirmation link
+// to the new address, and a notice to the current one. The account keeps its current address
+// until ConfirmEmailChange is called with that token.
+func (s *UserService) RequestEmailChange(context context.Context, user *models.User, newEmail string) error {
+	err := s.CheckEmailAvailable(context, newEmail)
+	if err != nil {
+		return err
+	}
+
+	err = s.TokenRepo.DeleteAllForUser(models.ScopeEmailChange, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := models.GenerateToken(user.ID, 24*time.Hour, models.ScopeEmailChange)
+	if err != nil {
+		return err
+	}
+	token.Email = &newEmail
+
+	err = s.TokenRepo.Insert(token)
+	if err != nil {
+		return err
+	}
+
+	s.sendEmail(newEmail, "email_change_confirm.tmpl", map[string]any{
+		"emailChangeToken": token.Plaintext,
+	})
+	s.sendEmail(user.Email, "email_change_notice.tmpl", map[string]any{
+		"newEmail": newEmail,
+	})
+
+	return nil
+}
+
+func (s *UserService) ConfirmEmailChange(context context.Context, tokenPlaintext string) (*models.User, error) {
+	token, err := s.TokenRepo.GetForPlaintext(models.ScopeEmailChange, tokenPlaintext)
 	if err != nil {
 		return nil, err
 	}
 
-	user.Activated = true
+	user, err := s.UserRepo.GetByID(context, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Email = *token.Email
 
 	err = s.UserRepo.Update(context, user)
 	if err != nil {
 		return nil, err
 	}
 
-	err = s.TokenRepo.DeleteAllForUser(models.ScopeActivation, user.ID)
+	err = s.TokenRepo.DeleteAllForUser(models.ScopeEmailChange, user.ID)
 	if err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
+
+// DeleteUser deletes user, whose stored tokens go with them. Their signed access tokens carry no
+// reference to the database and have to be cut off.
+func (s *UserService) DeleteUser(context context.Context, user *models.User) error {
+	err := s.UserRepo.Delete(context, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.TokenService.RevokeAccessTokens(user.ID)
+}
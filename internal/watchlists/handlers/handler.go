@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	movieModels "greenlight/internal/movies/models"
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/watchlists/models"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Repo interface {
+	AddToWatchlist(userID int64, entry *models.WatchlistEntry) (bool, error)
+	RemoveFromWatchlist(userID, movieID int64) error
+	GetWatchlist(userID int64, filters httphelpers.Filters) ([]*models.WatchlistEntry, httphelpers.Metadata, error)
+	AddWatched(userID int64, entry *models.WatchedEntry) error
+	RemoveWatched(userID, id int64) error
+	GetWatched(userID int64, filters httphelpers.Filters) ([]*models.WatchedEntry, httphelpers.Metadata, error)
+}
+
+type MovieRepo interface {
+	Get(id int64) (*movieModels.Movie, error)
+}
+
+// Handler serves the watchlist and watched history of the current user
+type Handler struct {
+	Repo      Repo
+	MovieRepo MovieRepo
+}
+
+func (h *Handler) ListWatchlist(c *gin.Context) {
+	filters, ok := readFilters(c, "-added_at", "added_at")
+	if !ok {
+		return
+	}
+
+	user := httphelpers.ContextGetUser(c)
+
+	entries, metadata, err := h.Repo.GetWatchlist(user.ID, filters)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"watchlist": entries, "metadata": metadata}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// AddToWatchlist puts a movie on the watchlist, responding with 201 when it wasn't there yet and
+// with the existing entry otherwise.
+func (h *Handler) AddToWatchlist(c *gin.Context) {
+	var input struct {
+		MovieID int64 `json:"movie_id"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	if models.ValidateMovieID(v, input.MovieID); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	movie, ok := h.readMovie(c, v, input.MovieID)
+	if !ok {
+		return
+	}
+
+	user := httphelpers.ContextGetUser(c)
+
+	entry := &models.WatchlistEntry{Movie: movie}
+
+	created, err := h.Repo.AddToWatchlist(user.ID, entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			v.AddError("movie_id", "no movie with this id")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, status, gin.H{"entry": entry}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) RemoveFromWatchlist(c *gin.Context) {
+	movieID, err := strconv.ParseInt(c.Param("movie_id"), 10, 64)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return
+	}
+
+	user := httphelpers.ContextGetUser(c)
+
+	err = h.Repo.RemoveFromWatchlist(user.ID, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "movie successfully removed from watchlist"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) ListWatched(c *gin.Context) {
+	filters, ok := readFilters(c, "-watched_at", "watched_at")
+	if !ok {
+		return
+	}
+
+	user := httphelpers.ContextGetUser(c)
+
+	entries, metadata, err := h.Repo.GetWatched(user.ID, filters)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"watched": entries, "metadata": metadata}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// AddWatched records a viewing of a movie, at watched_at or else now
+func (h *Handler) AddWatched(c *gin.Context) {
+	var input struct {
+		MovieID   int64      `json:"movie_id"`
+		WatchedAt *time.Time `json:"watched_at"`
+		Notes     string     `json:"notes"`
+	}
+
+	err := httphelpers.JSONDecode(c, &input)
+	if err != nil {
+		httphelpers.StatusBadRequestResponse(c, err.Error())
+		return
+	}
+
+	entry := &models.WatchedEntry{
+		Movie:     &movieModels.Movie{ID: input.MovieID},
+		WatchedAt: time.Now(),
+		Notes:     input.Notes,
+	}
+
+	if input.WatchedAt != nil {
+		entry.WatchedAt = *input.WatchedAt
+	}
+
+	v := validator.New()
+
+	if models.ValidateWatchedEntry(v, entry); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return
+	}
+
+	movie, ok := h.readMovie(c, v, input.MovieID)
+	if !ok {
+		return
+	}
+
+	entry.Movie = movie
+
+	user := httphelpers.ContextGetUser(c)
+
+	err = h.Repo.AddWatched(user.ID, entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			v.AddError("movie_id", "no movie with this id")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.StatusCreatedJSONPayload(c, gin.H{"entry": entry})
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) RemoveWatched(c *gin.Context) {
+	id, err := httphelpers.ReadIDParam(c)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return
+	}
+
+	user := httphelpers.ContextGetUser(c)
+
+	err = h.Repo.RemoveWatched(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusNotFoundResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return
+	}
+
+	err = httphelpers.CustomStatusJSONPayloadResponse(c, http.StatusOK, gin.H{"message": "entry successfully deleted"}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// readMovie loads the movie an entry is for, responding with 422 when it doesn't exist
+func (h *Handler) readMovie(c *gin.Context, v *validator.Validator, id int64) (*movieModels.Movie, bool) {
+	movie, err := h.MovieRepo.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			v.AddError("movie_id", "no movie with this id")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		return nil, false
+	}
+
+	return movie, true
+}
+
+// readFilters reads the paging and sorting of a list, which can be sorted by its timestamp
+// column or by the title, year and rating of the movies.
+func readFilters(c *gin.Context, defaultSort, timestampColumn string) (httphelpers.Filters, bool) {
+	v := validator.New()
+
+	qs := c.Request.URL.Query()
+
+	filters := httphelpers.Filters{
+		Page:         httphelpers.ReadInt(qs, "page", 1, v),
+		PageSize:     httphelpers.ReadInt(qs, "page_size", 20, v),
+		Sort:         httphelpers.ReadString(qs, "sort", defaultSort),
+		SortSafeList: []string{timestampColumn, "title", "year", "rating", "-" + timestampColumn, "-title", "-year", "-rating"},
+	}
+
+	if httphelpers.ValidateFilters(v, filters); !v.Valid() {
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+		return httphelpers.Filters{}, false
+	}
+
+	return filters, true
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	movieModels "greenlight/internal/movies/models"
+	"greenlight/pkg/validator"
+)
+
+// WatchlistEntry is a movie a user plans to watch
+type WatchlistEntry struct {
+	Movie   *movieModels.Movie `json:"movie"`
+	AddedAt time.Time          `json:"added_at"`
+}
+
+// WatchedEntry is one viewing of a movie, a user can watch the same movie many times
+type WatchedEntry struct {
+	ID        int64              `json:"id"`
+	Movie     *movieModels.Movie `json:"movie"`
+	WatchedAt time.Time          `json:"watched_at"`
+	Notes     string             `json:"notes"`
+}
+
+func ValidateMovieID(v *validator.Validator, movieID int64) {
+	v.Check(movieID != 0, "movie_id", "must be provided")
+	v.Check(movieID > 0, "movie_id", "must be a positive integer")
+}
+
+func ValidateWatchedEntry(v *validator.Validator, entry *WatchedEntry) {
+	ValidateMovieID(v, entry.Movie.ID)
+
+	v.Check(!entry.WatchedAt.After(time.Now()), "watched_at", "must not be in the future")
+
+	v.Check(len(entry.Notes) <= 1000, "notes", "must not be more than 1000 bytes long")
+}
@@ -0,0 +1,221 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	movieModels "greenlight/internal/movies/models"
+	"greenlight/internal/repositoryerrors"
+	"greenlight/internal/watchlists/models"
+	"greenlight/pkg/httphelpers"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	DB *sqlx.DB
+}
+
+func NewSqlxRepo(db *sqlx.DB) *Repo {
+	return &Repo{
+		DB: db,
+	}
+}
+
+// AddToWatchlist puts a movie on the watchlist of a user and reports whether it wasn't there
+// yet. Adding it again keeps the original entry. A missing movie gives ErrRecordNotFound.
+func (r *Repo) AddToWatchlist(userID int64, entry *models.WatchlistEntry) (bool, error) {
+	query := `
+	WITH inserted AS (
+		INSERT INTO watchlist (user_id, movie_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, movie_id) DO NOTHING
+		RETURNING added_at
+	)
+	SELECT added_at, true FROM inserted
+	UNION ALL
+	SELECT added_at, false FROM watchlist WHERE user_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var created bool
+
+	err := r.DB.QueryRowContext(ctx, query, userID, entry.Movie.ID).Scan(&entry.AddedAt, &created)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "watchlist" violates foreign key constraint "watchlist_movie_id_fkey"`:
+			return false, repositoryerrors.ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+
+	return created, nil
+}
+
+func (r *Repo) RemoveFromWatchlist(userID, movieID int64) error {
+	query := `DELETE FROM watchlist WHERE user_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return repositoryerrors.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *Repo) GetWatchlist(userID int64, filters httphelpers.Filters) ([]*models.WatchlistEntry, httphelpers.Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), watchlist.added_at, %s
+	FROM watchlist
+	INNER JOIN movies ON movies.id = watchlist.movie_id
+	WHERE watchlist.user_id = $1
+	ORDER BY %s %s, movies.id ASC
+	LIMIT $2 OFFSET $3`, movieColumns, filters.SortColumn(), filters.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, userID, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*models.WatchlistEntry{}
+
+	for rows.Next() {
+		entry := models.WatchlistEntry{Movie: &movieModels.Movie{}}
+
+		err := rows.Scan(append([]any{&totalRecords, &entry.AddedAt}, movieFields(entry.Movie)...)...)
+		if err != nil {
+			return nil, httphelpers.Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+
+	metadata := httphelpers.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
+
+// AddWatched records a viewing of a movie. A missing movie gives ErrRecordNotFound.
+func (r *Repo) AddWatched(userID int64, entry *models.WatchedEntry) error {
+	query := `
+	INSERT INTO watched (user_id, movie_id, watched_at, notes)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, watched_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, userID, entry.Movie.ID, entry.WatchedAt, entry.Notes).Scan(&entry.ID, &entry.WatchedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "watched" violates foreign key constraint "watched_movie_id_fkey"`:
+			return repositoryerrors.ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Repo) RemoveWatched(userID, id int64) error {
+	query := `DELETE FROM watched WHERE user_id = $1 AND id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, userID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return repositoryerrors.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *Repo) GetWatched(userID int64, filters httphelpers.Filters) ([]*models.WatchedEntry, httphelpers.Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), watched.id, watched.watched_at, watched.notes, %s
+	FROM watched
+	INNER JOIN movies ON movies.id = watched.movie_id
+	WHERE watched.user_id = $1
+	ORDER BY %s %s, watched.id ASC
+	LIMIT $2 OFFSET $3`, movieColumns, filters.SortColumn(), filters.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, userID, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*models.WatchedEntry{}
+
+	for rows.Next() {
+		entry := models.WatchedEntry{Movie: &movieModels.Movie{}}
+
+		err := rows.Scan(append([]any{&totalRecords, &entry.ID, &entry.WatchedAt, &entry.Notes}, movieFields(entry.Movie)...)...)
+		if err != nil {
+			return nil, httphelpers.Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, httphelpers.Metadata{}, err
+	}
+
+	metadata := httphelpers.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
+
+// movieColumns are the movie columns listed with the entries, read with movieFields
+const movieColumns = `movies.id, movies.title, movies.year, movies.runtime, movies.genres, movies.version, movies.rating, movies.rating_count`
+
+func movieFields(movie *movieModels.Movie) []any {
+	return []any{
+		&movie.ID,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		&movie.Genres,
+		&movie.Version,
+		&movie.Rating,
+		&movie.RatingCount,
+	}
+}
@@ -0,0 +1,36 @@
+package router
+
+import (
+	"greenlight/internal/permissions/models"
+	"greenlight/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	ListWatchlist(c *gin.Context)
+	AddToWatchlist(c *gin.Context)
+	RemoveFromWatchlist(c *gin.Context)
+	ListWatched(c *gin.Context)
+	AddWatched(c *gin.Context)
+	RemoveWatched(c *gin.Context)
+}
+
+type PermissionsRepo interface {
+	GetAllForUser(userID int64) (models.Permissions, error)
+}
+
+func InitRouter(engine *gin.RouterGroup, handler Handler, permissionsRepo PermissionsRepo) {
+	// Any reader keeps lists, API keys need a write scope to change them.
+	writeScope := middlewares.RequireScope("movies:write")
+
+	me := engine.Group("/users/me", middlewares.RequirePermission(permissionsRepo, "movies:read"))
+	{
+		me.GET("/watchlist", handler.ListWatchlist)
+		me.POST("/watchlist", writeScope, handler.AddToWatchlist)
+		me.DELETE("/watchlist/:movie_id", writeScope, handler.RemoveFromWatchlist)
+		me.GET("/watched", handler.ListWatched)
+		me.POST("/watched", writeScope, handler.AddWatched)
+		me.DELETE("/watched/:id", writeScope, handler.RemoveWatched)
+	}
+}
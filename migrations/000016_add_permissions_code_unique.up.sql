@@ -0,0 +1,13 @@
+-- Move grants of duplicated codes onto their oldest row before deleting the duplicates.
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users_permissions.user_id, kept.id
+FROM users_permissions
+INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+INNER JOIN (SELECT code, min(id) AS id FROM permissions GROUP BY code) kept ON kept.code = permissions.code
+ON CONFLICT DO NOTHING;
+
+DELETE FROM permissions duplicate
+USING permissions kept
+WHERE duplicate.code = kept.code AND duplicate.id > kept.id;
+
+ALTER TABLE permissions ADD CONSTRAINT permissions_code_key UNIQUE (code);
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code = 'movies:delete';
+DROP TABLE IF EXISTS permissions_implications;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS permissions_implications (
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    implied_permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (permission_id, implied_permission_id),
+    CHECK (permission_id <> implied_permission_id)
+);
+
+INSERT INTO permissions_implications (permission_id, implied_permission_id)
+SELECT permission.id, implied.id
+FROM permissions permission, permissions implied
+WHERE permission.code = 'movies:write' AND implied.code = 'movies:read';
+
+-- Deleting movies now needs its own permission, given to everyone who could delete them so far.
+INSERT INTO permissions (code)
+VALUES
+    ('movies:delete');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name IN ('editor', 'admin') AND permissions.code = 'movies:delete';
+
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users_permissions.user_id, deletion.id
+FROM users_permissions
+INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+INNER JOIN permissions deletion ON deletion.code = 'movies:delete'
+WHERE permissions.code = 'movies:write';
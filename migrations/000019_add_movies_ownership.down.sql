@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'movies:admin';
+DROP TABLE IF EXISTS movie_grants;
+ALTER TABLE movies DROP COLUMN IF EXISTS created_by;
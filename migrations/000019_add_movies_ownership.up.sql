@@ -0,0 +1,23 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS created_by bigint REFERENCES users ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS movie_grants (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (movie_id, user_id)
+);
+
+-- Add the permission to edit and delete every movie, not only the ones owned or granted.
+INSERT INTO permissions (code)
+VALUES
+    ('movies:admin');
+
+INSERT INTO permissions_implications (permission_id, implied_permission_id)
+SELECT permission.id, implied.id
+FROM permissions permission, permissions implied
+WHERE permission.code = 'movies:admin' AND implied.code IN ('movies:write', 'movies:delete');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'movies:admin';
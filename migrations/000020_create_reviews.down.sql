@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS movies_rating_idx;
+DROP TABLE IF EXISTS reviews;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_total;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_count;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating;
@@ -0,0 +1,79 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY,
+    slug text NOT NULL,
+    name text NOT NULL,
+    CONSTRAINT genres_slug_key UNIQUE (slug)
+);
+
+CREATE TABLE IF NOT EXISTS genre_aliases (
+    alias text PRIMARY KEY,
+    genre_id bigint NOT NULL REFERENCES genres ON DELETE CASCADE
+);
+
+INSERT INTO genres (slug, name)
+VALUES
+    ('action', 'Action'),
+    ('adventure', 'Adventure'),
+    ('animation', 'Animation'),
+    ('comedy', 'Comedy'),
+    ('crime', 'Crime'),
+    ('documentary', 'Documentary'),
+    ('drama', 'Drama'),
+    ('family', 'Family'),
+    ('fantasy', 'Fantasy'),
+    ('history', 'History'),
+    ('horror', 'Horror'),
+    ('music', 'Music'),
+    ('mystery', 'Mystery'),
+    ('romance', 'Romance'),
+    ('science-fiction', 'Science Fiction'),
+    ('thriller', 'Thriller'),
+    ('war', 'War'),
+    ('western', 'Western');
+
+INSERT INTO genre_aliases (alias, genre_id)
+SELECT aliases.alias, genres.id
+FROM (VALUES
+    ('sci-fi', 'science-fiction'),
+    ('scifi', 'science-fiction'),
+    ('sf', 'science-fiction'),
+    ('animated', 'animation'),
+    ('historical', 'history'),
+    ('musical', 'music'),
+    ('romantic', 'romance'),
+    ('documentaries', 'documentary')
+) AS aliases (alias, slug)
+INNER JOIN genres ON genres.slug = aliases.slug;
+
+-- Turn the genres of the existing movies into slugs the same way the API does: lowercase, with
+-- every run of other characters than letters and digits replaced by a dash. Slugs matching no
+-- genre or alias become new genres, named after their first spelling.
+CREATE TEMPORARY TABLE movie_genre_slugs AS
+SELECT movies.id AS movie_id, g.ordinality, g.name,
+    trim(BOTH '-' FROM regexp_replace(lower(g.name), '[^a-z0-9]+', '-', 'g')) AS slug
+FROM movies, unnest(movies.genres) WITH ORDINALITY AS g (name, ordinality);
+
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (slug) slug, name
+FROM movie_genre_slugs
+WHERE slug <> ''
+AND NOT EXISTS (SELECT 1 FROM genres WHERE genres.slug = movie_genre_slugs.slug)
+AND NOT EXISTS (SELECT 1 FROM genre_aliases WHERE genre_aliases.alias = movie_genre_slugs.slug)
+ORDER BY slug, movie_id, ordinality;
+
+UPDATE movies
+SET genres = normalized.genres, version = version + 1
+FROM (
+    SELECT movie_id, array_agg(canonical ORDER BY first_ordinality) AS genres
+    FROM (
+        SELECT movie_genre_slugs.movie_id, genres.slug AS canonical, min(movie_genre_slugs.ordinality) AS first_ordinality
+        FROM movie_genre_slugs
+        LEFT JOIN genre_aliases ON genre_aliases.alias = movie_genre_slugs.slug
+        INNER JOIN genres ON genres.slug = movie_genre_slugs.slug OR genres.id = genre_aliases.genre_id
+        GROUP BY movie_genre_slugs.movie_id, genres.slug
+    ) AS resolved
+    GROUP BY movie_id
+) AS normalized
+WHERE movies.id = normalized.movie_id AND movies.genres <> normalized.genres;
+
+DROP TABLE movie_genre_slugs;
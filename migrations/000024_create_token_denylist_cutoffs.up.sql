@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS token_denylist_cutoffs (
+    user_id bigint PRIMARY KEY,
+    not_before timestamp with time zone NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL
+);
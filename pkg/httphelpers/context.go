@@ -1,6 +1,7 @@
 package httphelpers
 
 import (
+	permissionsModels "greenlight/internal/permissions/models"
 	"greenlight/internal/users/models"
 
 	"github.com/gin-gonic/gin"
@@ -8,7 +9,12 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	tokenContextKey       = contextKey("token")
+	permissionsContextKey = contextKey("permissions")
+	scopeContextKey       = contextKey("scope")
+)
 
 func ContextSetUser(c *gin.Context, user *models.User) {
 	c.Set(string(userContextKey), user)
@@ -21,3 +27,46 @@ func ContextGetUser(c *gin.Context) *models.User {
 	}
 	return user.(*models.User)
 }
+
+// ContextSetToken stores the plaintext token the current request was authenticated with
+func ContextSetToken(c *gin.Context, tokenPlaintext string) {
+	c.Set(string(tokenContextKey), tokenPlaintext)
+}
+
+// ContextGetToken returns the plaintext token the current request was authenticated with,
+// or an empty string for anonymous requests
+func ContextGetToken(c *gin.Context) string {
+	return c.GetString(string(tokenContextKey))
+}
+
+// ContextSetPermissions stores the permissions of the request user, such as the ones carried by
+// a signed token
+func ContextSetPermissions(c *gin.Context, permissions permissionsModels.Permissions) {
+	c.Set(string(permissionsContextKey), permissions)
+}
+
+// ContextGetPermissions returns the permissions stored with ContextSetPermissions. The second
+// value is false when the permissions have to be looked up instead.
+func ContextGetPermissions(c *gin.Context) (permissionsModels.Permissions, bool) {
+	permissions, ok := c.Get(string(permissionsContextKey))
+	if !ok {
+		return nil, false
+	}
+	return permissions.(permissionsModels.Permissions), true
+}
+
+// ContextSetScope restricts the request to a subset of the user's permissions, such as the
+// ones granted to the API key it was authenticated with
+func ContextSetScope(c *gin.Context, scope permissionsModels.Permissions) {
+	c.Set(string(scopeContextKey), scope)
+}
+
+// ContextGetScope returns the scope stored with ContextSetScope. The second value is false when
+// the request may use every permission of the user.
+func ContextGetScope(c *gin.Context) (permissionsModels.Permissions, bool) {
+	scope, ok := c.Get(string(scopeContextKey))
+	if !ok {
+		return nil, false
+	}
+	return scope.(permissionsModels.Permissions), true
+}
@@ -0,0 +1,146 @@
+package httphelpers
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"greenlight/pkg/validator"
+)
+
+// FilterSpec holds the optional range and set filters of a list endpoint. Each filter is keyed
+// by the query parameter it was read from, repositories map the keys to their own columns.
+type FilterSpec struct {
+	IntRanges  []IntRange
+	TimeRanges []TimeRange
+	Sets       []SetFilter
+}
+
+// Set returns the set filter read from key, nil when there is none
+func (s FilterSpec) Set(key string) *SetFilter {
+	for i := range s.Sets {
+		if s.Sets[i].Key == key {
+			return &s.Sets[i]
+		}
+	}
+
+	return nil
+}
+
+// IntRange is an inclusive range read from <key>_min and <key>_max, a nil bound is open
+type IntRange struct {
+	Key string
+	Min *int
+	Max *int
+}
+
+// TimeRange is an exclusive range read from <key>_after and <key>_before, a nil bound is open
+type TimeRange struct {
+	Key    string
+	After  *time.Time
+	Before *time.Time
+}
+
+// SetFilter matches an array column read from <key> (contains all), <key>_any (contains at least
+// one) and <key>_exclude (contains none)
+type SetFilter struct {
+	Key     string
+	All     []string
+	Any     []string
+	Exclude []string
+}
+
+func ReadIntRange(qs url.Values, key string, v *validator.Validator) IntRange {
+	return IntRange{
+		Key: key,
+		Min: readOptionalInt(qs, key+"_min", v),
+		Max: readOptionalInt(qs, key+"_max", v),
+	}
+}
+
+func ReadTimeRange(qs url.Values, key string, v *validator.Validator) TimeRange {
+	return TimeRange{
+		Key:    key,
+		After:  readOptionalTime(qs, key+"_after", v),
+		Before: readOptionalTime(qs, key+"_before", v),
+	}
+}
+
+func ReadSetFilter(qs url.Values, key string) SetFilter {
+	return SetFilter{
+		Key:     key,
+		All:     ReadCSV(qs, key, []string{}),
+		Any:     ReadCSV(qs, key+"_any", []string{}),
+		Exclude: ReadCSV(qs, key+"_exclude", []string{}),
+	}
+}
+
+func readOptionalInt(qs url.Values, key string, v *validator.Validator) *int {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer")
+		return nil
+	}
+
+	return &i
+}
+
+// readOptionalTime accepts RFC 3339 timestamps as well as plain dates, which are read as midnight UTC
+func readOptionalTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return &t
+		}
+	}
+
+	v.AddError(key, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	return nil
+}
+
+func ValidateFilterSpec(v *validator.Validator, spec FilterSpec) {
+	for _, r := range spec.IntRanges {
+		// Bounds are compared with integer columns, which are 32 bits wide.
+		for key, bound := range map[string]*int{r.Key + "_min": r.Min, r.Key + "_max": r.Max} {
+			if bound != nil {
+				v.Check(*bound >= math.MinInt32 && *bound <= math.MaxInt32, key, fmt.Sprintf("must be between %d and %d", math.MinInt32, math.MaxInt32))
+			}
+		}
+
+		if r.Min != nil && r.Max != nil {
+			v.Check(*r.Min <= *r.Max, r.Key+"_max", fmt.Sprintf("must be greater than or equal to %s_min", r.Key))
+		}
+	}
+
+	for _, r := range spec.TimeRanges {
+		if r.After != nil && r.Before != nil {
+			v.Check(r.Before.After(*r.After), r.Key+"_before", fmt.Sprintf("must be later than %s_after", r.Key))
+		}
+	}
+
+	for _, s := range spec.Sets {
+		for key, values := range map[string][]string{s.Key: s.All, s.Key + "_any": s.Any, s.Key + "_exclude": s.Exclude} {
+			v.Check(!validator.PermittedValue("", values...), key, "must not contain empty values")
+			v.Check(len(values) <= 20, key, "must not contain more than 20 values")
+		}
+
+		for _, value := range s.Exclude {
+			excluded := validator.PermittedValue(value, s.All...) || validator.PermittedValue(value, s.Any...)
+			v.Check(!excluded, s.Key+"_exclude", fmt.Sprintf("must not contain %q which is also required", value))
+		}
+	}
+}
@@ -56,3 +56,20 @@ func ReadInt(qs url.Values, key string, defaultValue int, v *validator.Validator
 
 	return i
 }
+
+// ReadBool returns nil when key is missing, so callers can tell "not filtered" apart from false
+func ReadBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
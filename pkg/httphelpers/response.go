@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -139,6 +141,25 @@ func RateLimitExceededResponse(c *gin.Context) {
 	CustomStatusJSONPayloadResponse(c, http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"}, nil)
 }
 
+// AccountSuspendedResponse sets a 403 response for users whose account was suspended by an admin
+func AccountSuspendedResponse(c *gin.Context) {
+	CustomStatusJSONPayloadResponse(c, http.StatusForbidden, gin.H{"error": "your account has been suspended"}, nil)
+}
+
+// LoginThrottledResponse sets a 429 response, or a 423 one when the account is locked, with a
+// Retry-After header rounded up to the next second
+func LoginThrottledResponse(c *gin.Context, retryAfter time.Duration, locked bool) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	header := http.Header{"Retry-After": []string{strconv.Itoa(seconds)}}
+
+	if locked {
+		CustomStatusJSONPayloadResponse(c, http.StatusLocked, gin.H{"error": "account temporarily locked due to too many failed login attempts"}, header)
+		return
+	}
+
+	CustomStatusJSONPayloadResponse(c, http.StatusTooManyRequests, gin.H{"error": "too many failed login attempts, please try again later"}, header)
+}
+
 // If you do not want to handle the error, and are ok with a 400 response on error, feel free to use gin context's functions
 // such as c.JSON, c.XML, etc.
 // Valid ContentType: "application/json", "application/xml", "text/html"
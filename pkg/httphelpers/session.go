@@ -0,0 +1,89 @@
+package httphelpers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"greenlight/internal/users/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SessionCookie holds the authentication token of browser sessions
+	SessionCookie = "greenlight_session"
+	// RefreshCookie holds the refresh token of browser sessions, only sent to the refresh endpoint
+	RefreshCookie = "greenlight_refresh"
+	// CSRFCookie holds the CSRF token, readable by scripts so they can echo it in CSRFHeader
+	CSRFCookie = "greenlight_csrf"
+	CSRFHeader = "X-CSRF-Token"
+
+	refreshCookiePath = "/v1/tokens/refresh"
+)
+
+// CSRFToken derives the CSRF token of a session from its authentication token. As the session
+// cookie can't be read by scripts, only pages that were handed the CSRF token can send it, and
+// a CSRF cookie planted by another site doesn't match the session.
+func CSRFToken(sessionToken string) string {
+	sum := sha256.Sum256([]byte("csrf:" + sessionToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func ValidCSRFToken(sessionToken, csrfToken string) bool {
+	return subtle.ConstantTimeCompare([]byte(CSRFToken(sessionToken)), []byte(csrfToken)) == 1
+}
+
+// SetSessionCookies stores tokens in HttpOnly cookies, along with the CSRF token of the session.
+// The session and CSRF cookies are kept as long as the refresh token, the refresh endpoint
+// checks the CSRF token against the expired session token. secure has to be false to use the
+// cookies over plain HTTP, when developing.
+func SetSessionCookies(c *gin.Context, tokens *models.AuthenticationTokens, secure bool) {
+	expiry := tokens.Access.Expiry
+	if tokens.Refresh != nil {
+		expiry = tokens.Refresh.Expiry
+	}
+
+	setCookie(c, SessionCookie, tokens.Access.Plaintext, "/", expiry, true, secure)
+	setCookie(c, CSRFCookie, CSRFToken(tokens.Access.Plaintext), "/", expiry, false, secure)
+
+	if tokens.Refresh != nil {
+		setCookie(c, RefreshCookie, tokens.Refresh.Plaintext, refreshCookiePath, tokens.Refresh.Expiry, true, secure)
+	}
+}
+
+func ClearSessionCookies(c *gin.Context, secure bool) {
+	setCookie(c, SessionCookie, "", "/", time.Unix(0, 0), true, secure)
+	setCookie(c, CSRFCookie, "", "/", time.Unix(0, 0), false, secure)
+	setCookie(c, RefreshCookie, "", refreshCookiePath, time.Unix(0, 0), true, secure)
+}
+
+// IsSafeMethod reports whether method can't change anything, so it doesn't need a CSRF token
+func IsSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+func setCookie(c *gin.Context, name, value, path string, expiry time.Time, httpOnly, secure bool) {
+	maxAge := int(time.Until(expiry).Seconds())
+	if maxAge <= 0 {
+		maxAge = -1
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Expires:  expiry,
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
@@ -4,9 +4,11 @@ import (
 	"errors"
 	"strings"
 
+	apiKeyModels "greenlight/internal/apikeys/models"
 	"greenlight/internal/repositoryerrors"
 	userModels "greenlight/internal/users/models"
 	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/signedtoken"
 	"greenlight/pkg/validator"
 
 	"github.com/gin-gonic/gin"
@@ -16,25 +18,70 @@ type UserRepo interface {
 	GetForToken(tokenScope, tokenPlaintext string) (*userModels.User, error)
 }
 
-func Authenticate(UserRepo UserRepo) gin.HandlerFunc {
+type APIKeyRepo interface {
+	GetForPlaintext(plaintext string) (*apiKeyModels.APIKey, *userModels.User, error)
+	Touch(id int64) error
+}
+
+// Authenticate loads the user of the request credentials into the context. Bearer tokens are
+// read from the Authorization header, API keys from either "Authorization: ApiKey <key>" or the
+// X-API-Key header, and, without either header, browser sessions from the session cookie.
+// Signed tokens are only accepted when authority is not nil, and are verified without touching
+// the database.
+func Authenticate(UserRepo UserRepo, authority *signedtoken.Authority, apiKeyRepo APIKeyRepo) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Vary", "Authorization")
+		c.Writer.Header().Add("Vary", "X-API-Key")
+		c.Writer.Header().Add("Vary", "Cookie")
 
 		authorizationHeader := c.GetHeader("Authorization")
-		if authorizationHeader == "" {
-			httphelpers.ContextSetUser(c, userModels.AnonymousUser)
-			c.Next()
+		apiKey := c.GetHeader("X-API-Key")
+
+		if authorizationHeader == "" && apiKey == "" {
+			authenticateSession(c, UserRepo, authority)
 			return
 		}
 
-		headerParts := strings.Split(authorizationHeader, " ")
-		if len(headerParts) != 2 || strings.ToLower(headerParts[0]) != "bearer" {
-			httphelpers.StatusUnauthorizedResponse(c)
-			c.Abort()
+		var token string
+
+		if authorizationHeader != "" {
+			headerParts := strings.Split(authorizationHeader, " ")
+			if len(headerParts) != 2 {
+				httphelpers.StatusUnauthorizedResponse(c)
+				c.Abort()
+				return
+			}
+
+			switch strings.ToLower(headerParts[0]) {
+			case "bearer":
+				token = headerParts[1]
+			case "apikey":
+				apiKey = headerParts[1]
+			default:
+				httphelpers.StatusUnauthorizedResponse(c)
+				c.Abort()
+				return
+			}
+		}
+
+		if token == "" {
+			authenticateAPIKey(c, apiKeyRepo, apiKey)
 			return
 		}
 
-		token := headerParts[1]
+		if authority != nil && signedtoken.IsSigned(token) {
+			claims, err := authority.Verify(token)
+			if err != nil {
+				httphelpers.StatusUnauthorizedResponse(c)
+				c.Abort()
+				return
+			}
+
+			httphelpers.ContextSetUser(c, &userModels.User{ID: claims.Subject, Activated: claims.Activated})
+			httphelpers.ContextSetToken(c, token)
+			httphelpers.ContextSetPermissions(c, claims.Permissions)
+			return
+		}
 
 		v := validator.New()
 		if userModels.ValidateTokenPlaintext(v, token); !v.Valid() {
@@ -56,5 +103,85 @@ func Authenticate(UserRepo UserRepo) gin.HandlerFunc {
 		}
 
 		httphelpers.ContextSetUser(c, user)
+		httphelpers.ContextSetToken(c, token)
+	}
+}
+
+// authenticateSession authenticates browser sessions. Requests with a missing, expired or revoked
+// session cookie are anonymous rather than rejected, so the public endpoints keep working, but a
+// valid session needs the CSRF token for every unsafe method.
+func authenticateSession(c *gin.Context, UserRepo UserRepo, authority *signedtoken.Authority) {
+	token, err := c.Cookie(httphelpers.SessionCookie)
+	if err != nil || token == "" {
+		httphelpers.ContextSetUser(c, userModels.AnonymousUser)
+		return
+	}
+
+	var (
+		user   *userModels.User
+		claims *signedtoken.Claims
+	)
+
+	if authority != nil && signedtoken.IsSigned(token) {
+		claims, err = authority.Verify(token)
+		if err == nil {
+			user = &userModels.User{ID: claims.Subject, Activated: claims.Activated}
+		}
+	} else {
+		v := validator.New()
+		if userModels.ValidateTokenPlaintext(v, token); v.Valid() {
+			user, err = UserRepo.GetForToken(userModels.ScopeAuthentication, token)
+			if err != nil && !errors.Is(err, repositoryerrors.ErrRecordNotFound) {
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+				c.Abort()
+				return
+			}
+		}
+	}
+
+	if user == nil {
+		httphelpers.ContextSetUser(c, userModels.AnonymousUser)
+		return
 	}
+
+	if !httphelpers.IsSafeMethod(c.Request.Method) && !httphelpers.ValidCSRFToken(token, c.GetHeader(httphelpers.CSRFHeader)) {
+		httphelpers.StatusForbiddenJSONPayloadResponse(c, gin.H{"error": "invalid or missing CSRF token"})
+		c.Abort()
+		return
+	}
+
+	httphelpers.ContextSetUser(c, user)
+	httphelpers.ContextSetToken(c, token)
+	if claims != nil {
+		httphelpers.ContextSetPermissions(c, claims.Permissions)
+	}
+}
+
+func authenticateAPIKey(c *gin.Context, apiKeyRepo APIKeyRepo, plaintext string) {
+	v := validator.New()
+	if apiKeyModels.ValidateAPIKeyPlaintext(v, plaintext); !v.Valid() {
+		httphelpers.StatusUnauthorizedResponse(c)
+		c.Abort()
+		return
+	}
+
+	key, user, err := apiKeyRepo.GetForPlaintext(plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositoryerrors.ErrRecordNotFound):
+			httphelpers.StatusUnauthorizedResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		c.Abort()
+		return
+	}
+
+	// Failing to record the last use shouldn't fail the request, the error is only logged.
+	if err := apiKeyRepo.Touch(key.ID); err != nil {
+		c.Error(err)
+	}
+
+	httphelpers.ContextSetUser(c, user)
+	httphelpers.ContextSetScope(c, key.Permissions)
 }
@@ -0,0 +1,163 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrUnknownKey = errors.New("unknown id token signing key")
+
+// minRefreshInterval stops tokens with made up key IDs from hammering the provider
+const minRefreshInterval = time.Minute
+
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+// keySet caches the provider's signing keys, and fetches them again when a token is signed
+// with a key it doesn't know, as happens after the provider rotates its keys. Refreshes run
+// without holding the lock, lookups of known keys never wait for the provider.
+type keySet struct {
+	uri    string
+	client *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	refreshedAt time.Time
+	// refreshing is closed when the refresh in progress, if any, is over
+	refreshing chan struct{}
+}
+
+func newKeySet(uri string, client *http.Client, now func() time.Time) *keySet {
+	return &keySet{
+		uri:    uri,
+		client: client,
+		now:    now,
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+}
+
+func (s *keySet) get(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+
+	if key, ok := s.keys[keyID]; ok {
+		s.mu.Unlock()
+		return key, nil
+	}
+
+	// Lookups arriving during a refresh wait for it rather than start their own.
+	if refreshing := s.refreshing; refreshing != nil {
+		s.mu.Unlock()
+
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		return s.lookup(keyID)
+	}
+
+	if s.now().Sub(s.refreshedAt) < minRefreshInterval {
+		s.mu.Unlock()
+		return nil, ErrUnknownKey
+	}
+
+	// The attempt counts even when it fails, so an unreachable provider isn't retried on every
+	// login either.
+	s.refreshedAt = s.now()
+	refreshing := make(chan struct{})
+	s.refreshing = refreshing
+	s.mu.Unlock()
+
+	keys, err := s.fetch()
+
+	s.mu.Lock()
+	if err == nil {
+		s.keys = keys
+	}
+	s.refreshing = nil
+	close(refreshing)
+	s.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.lookup(keyID)
+}
+
+func (s *keySet) lookup(keyID string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// fetch reads the provider's keys. It isn't bound to the context of the lookup that started it,
+// other lookups may be waiting for it.
+func (s *keySet) fetch() (map[string]*rsa.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	err := getJSON(ctx, s.client, s.uri, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+
+	for _, k := range set.Keys {
+		if k.KeyType != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		key, err := parseRSAKey(k)
+		if err != nil {
+			continue
+		}
+
+		keys[k.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+func parseRSAKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("unsupported rsa key")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
@@ -0,0 +1,429 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientID = "greenlight"
+
+// fakeProvider is an in-process OpenID Connect provider. It checks the PKCE challenge at its
+// token endpoint, signs ID tokens with its newest key and publishes every key it ever had.
+type fakeProvider struct {
+	server *httptest.Server
+
+	mu          sync.Mutex
+	keys        []fakeKey
+	codes       map[string]fakeAuthorization
+	issued      int
+	jwksStatus  int
+	jwksHold    chan struct{}
+	jwksFetches int
+}
+
+type fakeKey struct {
+	id  string
+	key *rsa.PrivateKey
+}
+
+type fakeAuthorization struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+
+	f := &fakeProvider{codes: make(map[string]fakeAuthorization), jwksStatus: http.StatusOK}
+	f.rotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", f.discovery)
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) })
+	mux.HandleFunc("/token", f.token)
+	mux.HandleFunc("/jwks", f.jwks)
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func (f *fakeProvider) rotateKey(t *testing.T) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.keys = append(f.keys, fakeKey{id: fmt.Sprintf("key-%d", len(f.keys)+1), key: key})
+}
+
+// authorize plays the user signing in at authCodeURL, and returns the code sent back with state
+func (f *fakeProvider) authorize(t *testing.T, authCodeURL string) string {
+	t.Helper()
+
+	u, err := url.Parse(authCodeURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := u.Query()
+	if query.Get("client_id") != testClientID || query.Get("code_challenge_method") != "S256" || query.Get("response_type") != "code" {
+		t.Fatalf("unexpected authorization request %s", authCodeURL)
+	}
+
+	f.mu.Lock()
+	f.issued++
+	code := fmt.Sprintf("code-%d", f.issued)
+	f.codes[code] = fakeAuthorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	f.mu.Unlock()
+
+	return code
+}
+
+func (f *fakeProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 f.server.URL,
+		"authorization_endpoint": f.server.URL + "/authorize",
+		"token_endpoint":         f.server.URL + "/token",
+		"jwks_uri":               f.server.URL + "/jwks",
+	})
+}
+
+func (f *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	authorization, ok := f.codes[r.PostFormValue("code")]
+	delete(f.codes, r.PostFormValue("code"))
+	signingKey := f.keys[len(f.keys)-1]
+	f.mu.Unlock()
+
+	if !ok || CodeChallenge(r.PostFormValue("code_verifier")) != authorization.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+
+	idToken := signIDToken(signingKey, map[string]any{
+		"iss":            f.server.URL,
+		"sub":            "subject-1",
+		"aud":            testClientID,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          authorization.nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+	})
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func (f *fakeProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.jwksFetches++
+	hold, status := f.jwksHold, f.jwksStatus
+	keys := append([]fakeKey(nil), f.keys...)
+	f.mu.Unlock()
+
+	if hold != nil {
+		<-hold
+	}
+
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+
+	for _, k := range keys {
+		set.Keys = append(set.Keys, jwk{
+			KeyType: "RSA",
+			KeyID:   k.id,
+			Use:     "sig",
+			N:       base64.RawURLEncoding.EncodeToString(k.key.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.E)).Bytes()),
+		})
+	}
+
+	json.NewEncoder(w).Encode(set)
+}
+
+func (f *fakeProvider) fetches() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.jwksFetches
+}
+
+func signIDToken(k fakeKey, claims map[string]any) string {
+	segment := func(v any) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signed := segment(map[string]string{"alg": "RS256", "kid": k.id}) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, k.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// clock is an adjustable Provider.now
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func discoverFake(t *testing.T, f *fakeProvider) (*Provider, *clock) {
+	t.Helper()
+
+	p, err := Discover(context.Background(), Config{
+		Issuer:      f.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://greenlight.test/callback",
+	}, f.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &clock{now: time.Now()}
+	p.now = c.Now
+
+	return p, c
+}
+
+// login runs the authorization code flow, exchanging with verifier and nonce, which default to
+// the ones sent to the provider when empty
+func login(t *testing.T, f *fakeProvider, p *Provider, verifier, nonce string) (*Claims, error) {
+	t.Helper()
+
+	sentVerifier, _ := NewRandom()
+	sentNonce, _ := NewRandom()
+
+	if verifier == "" {
+		verifier = sentVerifier
+	}
+	if nonce == "" {
+		nonce = sentNonce
+	}
+
+	code := f.authorize(t, p.AuthCodeURL("state", sentNonce, sentVerifier))
+
+	return p.Exchange(context.Background(), code, verifier, nonce)
+}
+
+func TestExchangePKCE(t *testing.T) {
+	f := newFakeProvider(t)
+	p, _ := discoverFake(t, f)
+
+	claims, err := login(t, f, p, "", "")
+	if err != nil {
+		t.Fatalf("login with the right verifier: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	_, err = login(t, f, p, "wrong-verifier", "")
+	if !errors.Is(err, ErrExchangeFailed) {
+		t.Errorf("login with the wrong verifier: got %v, want ErrExchangeFailed", err)
+	}
+}
+
+func TestExchangeNonce(t *testing.T) {
+	f := newFakeProvider(t)
+	p, _ := discoverFake(t, f)
+
+	_, err := login(t, f, p, "", "another-nonce")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("got %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestVerifyIDTokenRejectsForgedTokens(t *testing.T) {
+	f := newFakeProvider(t)
+	p, _ := discoverFake(t, f)
+
+	stranger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":   f.server.URL,
+		"sub":   "subject-1",
+		"aud":   testClientID,
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nonce": "nonce",
+	}
+
+	// Signed by a key that isn't the provider's, under the provider's key ID.
+	forged := signIDToken(fakeKey{id: "key-1", key: stranger}, claims)
+
+	_, err = p.VerifyIDToken(context.Background(), forged, "nonce")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("got %v, want ErrInvalidIDToken", err)
+	}
+
+	claims["aud"] = "someone-else"
+	_, err = p.VerifyIDToken(context.Background(), signIDToken(f.keys[0], claims), "nonce")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("other audience: got %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	f := newFakeProvider(t)
+	p, c := discoverFake(t, f)
+
+	_, err := login(t, f, p, "", "")
+	if err != nil {
+		t.Fatalf("login before rotation: %v", err)
+	}
+
+	f.rotateKey(t)
+
+	// The keys were fetched moments ago, the new one is only picked up once the refresh
+	// interval is over.
+	_, err = login(t, f, p, "", "")
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("login right after rotation: got %v, want ErrUnknownKey", err)
+	}
+
+	c.Advance(minRefreshInterval)
+
+	_, err = login(t, f, p, "", "")
+	if err != nil {
+		t.Fatalf("login after rotation: %v", err)
+	}
+
+	if got := f.fetches(); got != 2 {
+		t.Errorf("got %d key fetches, want 2", got)
+	}
+}
+
+func TestFailedKeyRefreshIsRateLimited(t *testing.T) {
+	f := newFakeProvider(t)
+	p, c := discoverFake(t, f)
+
+	f.mu.Lock()
+	f.jwksStatus = http.StatusInternalServerError
+	f.mu.Unlock()
+
+	_, err := login(t, f, p, "", "")
+	if err == nil || errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("login with the keys unavailable: got %v, want the fetch error", err)
+	}
+
+	f.mu.Lock()
+	f.jwksStatus = http.StatusOK
+	f.mu.Unlock()
+
+	_, err = login(t, f, p, "", "")
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("login right after the failed fetch: got %v, want ErrUnknownKey", err)
+	}
+
+	if got := f.fetches(); got != 1 {
+		t.Errorf("got %d key fetches, want 1", got)
+	}
+
+	c.Advance(minRefreshInterval)
+
+	_, err = login(t, f, p, "", "")
+	if err != nil {
+		t.Fatalf("login after the refresh interval: %v", err)
+	}
+}
+
+func TestKeyRefreshDoesNotBlockKnownKeys(t *testing.T) {
+	f := newFakeProvider(t)
+	p, c := discoverFake(t, f)
+
+	_, err := login(t, f, p, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hold := make(chan struct{})
+	f.mu.Lock()
+	f.jwksHold = hold
+	f.mu.Unlock()
+
+	c.Advance(minRefreshInterval)
+
+	refreshed := make(chan error)
+	go func() {
+		_, err := p.keys.get(context.Background(), "key-unknown")
+		refreshed <- err
+	}()
+
+	// Wait for the refresh to reach the provider.
+	for f.fetches() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = p.keys.get(ctx, "key-1")
+	if err != nil {
+		t.Errorf("known key during a refresh: %v", err)
+	}
+
+	// Unknown keys wait for the refresh in progress, within their own deadline.
+	_, err = p.keys.get(ctx, "key-other")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unknown key during a refresh: got %v, want context.DeadlineExceeded", err)
+	}
+
+	close(hold)
+
+	err = <-refreshed
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("refreshing lookup: got %v, want ErrUnknownKey", err)
+	}
+}
@@ -0,0 +1,56 @@
+package passwordhash
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt hashes passwords with bcrypt, whose hashes already carry the cost. Passwords longer
+// than 72 bytes are rejected when hashing, since bcrypt would silently ignore the rest.
+type Bcrypt struct {
+	Cost int
+}
+
+func NewBcrypt(cost int) *Bcrypt {
+	return &Bcrypt{
+		Cost: cost,
+	}
+}
+
+func (b *Bcrypt) Hash(password string) ([]byte, error) {
+	if len(password) > 72 {
+		return nil, bcrypt.ErrPasswordTooLong
+	}
+
+	return bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+}
+
+func (b *Bcrypt) Verify(hash []byte, password string) (bool, error) {
+	// No bcrypt hash was ever produced from a longer password.
+	if len(password) > 72 {
+		return false, nil
+	}
+
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (b *Bcrypt) Identifies(hash []byte) bool {
+	_, err := bcrypt.Cost(hash)
+	return err == nil
+}
+
+func (b *Bcrypt) Outdated(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost < b.Cost
+}
@@ -0,0 +1,69 @@
+package passwordhash
+
+import (
+	"errors"
+)
+
+var ErrUnknownAlgorithm = errors.New("passwordhash: unknown hash algorithm")
+
+// Algorithm hashes passwords into self-describing strings, carrying the algorithm and its
+// parameters, and verifies passwords against the strings it produced.
+type Algorithm interface {
+	Hash(password string) ([]byte, error)
+	Verify(hash []byte, password string) (bool, error)
+	// Identifies reports whether hash was produced by this algorithm
+	Identifies(hash []byte) bool
+	// Outdated reports whether hash was produced with weaker parameters than the current ones
+	Outdated(hash []byte) bool
+}
+
+// Hasher hashes new passwords with its preferred algorithm, while still verifying hashes
+// produced by any of the legacy ones.
+type Hasher struct {
+	preferred Algorithm
+	legacy    []Algorithm
+}
+
+func New(preferred Algorithm, legacy ...Algorithm) *Hasher {
+	return &Hasher{
+		preferred: preferred,
+		legacy:    legacy,
+	}
+}
+
+func (h *Hasher) Hash(password string) ([]byte, error) {
+	return h.preferred.Hash(password)
+}
+
+func (h *Hasher) Verify(hash []byte, password string) (bool, error) {
+	algorithm, err := h.algorithmFor(hash)
+	if err != nil {
+		return false, err
+	}
+
+	return algorithm.Verify(hash, password)
+}
+
+// NeedsRehash reports whether hash should be replaced, because it was produced either by a
+// legacy algorithm or with outdated parameters
+func (h *Hasher) NeedsRehash(hash []byte) bool {
+	if !h.preferred.Identifies(hash) {
+		return true
+	}
+
+	return h.preferred.Outdated(hash)
+}
+
+func (h *Hasher) algorithmFor(hash []byte) (Algorithm, error) {
+	if h.preferred.Identifies(hash) {
+		return h.preferred, nil
+	}
+
+	for _, algorithm := range h.legacy {
+		if algorithm.Identifies(hash) {
+			return algorithm, nil
+		}
+	}
+
+	return nil, ErrUnknownAlgorithm
+}
@@ -0,0 +1,208 @@
+package passwordpolicy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxLineLength bounds the "HASH:COUNT" lines of breached lists, which are far shorter
+const maxLineLength = 128
+
+type Logger interface {
+	PrintError(err error, properties map[string]string)
+}
+
+// BreachedList looks passwords up in a Have I Been Pwned corpus of SHA-1 hashes, without
+// loading it in memory, so lookups never need the network. It reads either a single file of
+// "HASH:COUNT" lines sorted by hash, like the "ordered by hash" download, or a directory of range
+// files holding "SUFFIX:COUNT" lines sorted by suffix, named after the first five hex characters
+// of their hashes like those written by the PwnedPasswordsDownloader ("ABCDE.txt" or "ABCDE").
+// Both are binary searched, counts are ignored.
+type BreachedList struct {
+	dir    string
+	file   *os.File
+	size   int64
+	logger Logger
+}
+
+// OpenBreachedList opens the list at path, a file or a directory as described on BreachedList.
+// Lookup errors are logged to logger, and the password is then treated as not breached.
+func OpenBreachedList(path string, logger Logger) (*BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &BreachedList{dir: path, logger: logger}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the first entry is checked, a file that isn't sorted can't be told apart cheaply.
+	first, found, err := firstKeyFrom(file, 0, info.Size())
+	if err == nil && (!found || len(first) != 40 || !isHex(first)) {
+		err = fmt.Errorf("passwordpolicy: %s doesn't start with a HASH:COUNT entry", path)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &BreachedList{file: file, size: info.Size(), logger: logger}, nil
+}
+
+func (l *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	found, err := l.contains(hash)
+	if err != nil {
+		l.logger.PrintError(err, nil)
+		return false
+	}
+
+	return found
+}
+
+func (l *BreachedList) Close() error {
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Close()
+}
+
+func (l *BreachedList) contains(hash string) (bool, error) {
+	if l.file != nil {
+		return search(l.file, l.size, hash)
+	}
+
+	prefix, suffix := hash[:5], hash[5:]
+
+	for _, name := range []string{prefix + ".txt", prefix} {
+		file, err := os.Open(filepath.Join(l.dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			return false, err
+		}
+
+		return search(file, info.Size(), suffix)
+	}
+
+	return false, nil
+}
+
+// search binary searches the sorted lines of r for one whose key, the part before the colon,
+// is key. It looks for the first offset whose next line has a key of at least key.
+func search(r io.ReaderAt, size int64, key string) (bool, error) {
+	low, high := int64(0), size
+
+	for low < high {
+		middle := low + (high-low)/2
+
+		next, found, err := firstKeyFrom(r, middle, size)
+		if err != nil {
+			return false, err
+		}
+
+		if !found || next >= key {
+			high = middle
+		} else {
+			low = middle + 1
+		}
+	}
+
+	next, found, err := firstKeyFrom(r, low, size)
+	if err != nil {
+		return false, err
+	}
+
+	return found && next == key, nil
+}
+
+// firstKeyFrom returns the uppercased key of the first line starting at or after offset, and
+// false when there is none
+func firstKeyFrom(r io.ReaderAt, offset, size int64) (string, bool, error) {
+	// offset only starts a line when the byte before it ends one.
+	if offset > 0 {
+		chunk, err := readChunk(r, offset-1, size)
+		if err != nil {
+			return "", false, err
+		}
+
+		end := bytes.IndexByte(chunk, '\n')
+		if end < 0 {
+			if offset-1+int64(len(chunk)) < size {
+				return "", false, fmt.Errorf("passwordpolicy: line longer than %d bytes", maxLineLength)
+			}
+			return "", false, nil
+		}
+
+		offset += int64(end)
+	}
+
+	if offset >= size {
+		return "", false, nil
+	}
+
+	chunk, err := readChunk(r, offset, size)
+	if err != nil {
+		return "", false, err
+	}
+
+	line := chunk
+	if end := bytes.IndexByte(chunk, '\n'); end >= 0 {
+		line = chunk[:end]
+	} else if offset+int64(len(chunk)) < size {
+		return "", false, fmt.Errorf("passwordpolicy: line longer than %d bytes", maxLineLength)
+	}
+
+	key, _, _ := strings.Cut(strings.TrimSpace(string(line)), ":")
+
+	return strings.ToUpper(key), true, nil
+}
+
+func readChunk(r io.ReaderAt, offset, size int64) ([]byte, error) {
+	length := int64(maxLineLength)
+	if size-offset < length {
+		length = size - offset
+	}
+
+	chunk := make([]byte, length)
+
+	_, err := r.ReadAt(chunk, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return chunk, nil
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789ABCDEFabcdef", r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,115 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Policy decides whether a password is strong enough. Breached is optional, without it
+// passwords are not checked against known breaches.
+type Policy struct {
+	MinEntropy float64
+	Breached   *BreachedList
+}
+
+func New(minEntropy float64, breached *BreachedList) *Policy {
+	return &Policy{
+		MinEntropy: minEntropy,
+		Breached:   breached,
+	}
+}
+
+// Check returns the first rule password breaks, or an empty string when it follows them all.
+// personal holds information about the user, such as their name or email address, which the
+// password must not contain.
+func (p *Policy) Check(password string, personal ...string) string {
+	if Entropy(password) < p.MinEntropy {
+		return "is too easy to guess, use a longer password or mix in other kinds of characters"
+	}
+
+	lowerPassword := strings.ToLower(password)
+	for _, word := range personalWords(personal) {
+		if strings.Contains(lowerPassword, word) {
+			return "must not contain your name or email address"
+		}
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		return "has appeared in a data breach, please choose a different one"
+	}
+
+	return ""
+}
+
+// Entropy estimates the bits of entropy of password from the kinds of characters it uses and
+// its length, where runs of the same character only count once.
+func Entropy(password string) float64 {
+	var (
+		lower, upper, digit, symbol, other bool
+		length                             int
+		previous                           rune = -1
+	)
+
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+
+		if r != previous {
+			length++
+		}
+		previous = r
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	return float64(length) * math.Log2(float64(pool))
+}
+
+// personalWords splits names and email addresses into the lowercased words a password must
+// not contain. Words shorter than three characters are too common to be worth rejecting.
+func personalWords(personal []string) []string {
+	var words []string
+
+	for _, value := range personal {
+		value = strings.ToLower(value)
+
+		if local, _, found := strings.Cut(value, "@"); found {
+			value = local
+		}
+
+		fields := strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+
+		for _, field := range fields {
+			if len(field) >= 3 {
+				words = append(words, field)
+			}
+		}
+	}
+
+	return words
+}
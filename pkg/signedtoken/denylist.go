@@ -0,0 +1,146 @@
+package signedtoken
+
+import (
+	"sync"
+	"time"
+)
+
+type Logger interface {
+	PrintError(err error, properties map[string]string)
+}
+
+// AllUsers is the user ID of cutoffs that apply to the tokens of every user
+const AllUsers int64 = 0
+
+// Cutoff denies every token of a user issued at or before NotBefore, until Expiry when the last
+// of them has expired anyway
+type Cutoff struct {
+	NotBefore time.Time
+	Expiry    time.Time
+}
+
+type DenylistStore interface {
+	Insert(tokenID string, expiry time.Time) error
+	GetAllActive() (map[string]time.Time, error)
+	InsertCutoff(userID int64, cutoff Cutoff) error
+	GetAllActiveCutoffs() (map[int64]Cutoff, error)
+	DeleteExpired() error
+}
+
+// Denylist keeps the IDs of revoked tokens, and the per-user cutoffs, until they expire. Lookups
+// are served from memory, which is reloaded from the store periodically so revocations made by
+// other instances are picked up.
+type Denylist struct {
+	mu      sync.RWMutex
+	store   DenylistStore
+	entries map[string]time.Time
+	cutoffs map[int64]Cutoff
+}
+
+func NewDenylist(store DenylistStore, refreshInterval time.Duration, logger Logger) (*Denylist, error) {
+	d := &Denylist{
+		store:   store,
+		entries: make(map[string]time.Time),
+		cutoffs: make(map[int64]Cutoff),
+	}
+
+	err := d.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			time.Sleep(refreshInterval)
+
+			err := d.store.DeleteExpired()
+			if err != nil {
+				logger.PrintError(err, nil)
+			}
+
+			err = d.reload()
+			if err != nil {
+				logger.PrintError(err, nil)
+			}
+		}
+	}()
+
+	return d, nil
+}
+
+func (d *Denylist) Add(tokenID string, expiry time.Time) error {
+	err := d.store.Insert(tokenID, expiry)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.entries[tokenID] = expiry
+	d.mu.Unlock()
+
+	return nil
+}
+
+func (d *Denylist) Contains(tokenID string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	expiry, found := d.entries[tokenID]
+	return found && time.Now().Before(expiry)
+}
+
+// AddCutoff denies the tokens of userID, or of every user for AllUsers, issued up to now. Only
+// the latest cutoff of a user is kept.
+func (d *Denylist) AddCutoff(userID int64, cutoff Cutoff) error {
+	err := d.store.InsertCutoff(userID, cutoff)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	if current, found := d.cutoffs[userID]; !found || cutoff.NotBefore.After(current.NotBefore) {
+		d.cutoffs[userID] = cutoff
+	}
+	d.mu.Unlock()
+
+	return nil
+}
+
+// NotBefore returns the latest active cutoff applying to the tokens of userID, and false when
+// there is none
+func (d *Denylist) NotBefore(userID int64) (time.Time, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var notBefore time.Time
+	found := false
+
+	for _, id := range []int64{userID, AllUsers} {
+		cutoff, ok := d.cutoffs[id]
+		if ok && time.Now().Before(cutoff.Expiry) && cutoff.NotBefore.After(notBefore) {
+			notBefore = cutoff.NotBefore
+			found = true
+		}
+	}
+
+	return notBefore, found
+}
+
+func (d *Denylist) reload() error {
+	entries, err := d.store.GetAllActive()
+	if err != nil {
+		return err
+	}
+
+	cutoffs, err := d.store.GetAllActiveCutoffs()
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.entries = entries
+	d.cutoffs = cutoffs
+	d.mu.Unlock()
+
+	return nil
+}
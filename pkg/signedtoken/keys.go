@@ -0,0 +1,102 @@
+package signedtoken
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Algorithm string
+
+const (
+	AlgorithmHS256 Algorithm = "HS256"
+	AlgorithmEdDSA Algorithm = "EdDSA"
+)
+
+var ErrInvalidKey = errors.New("invalid signing key")
+
+// Key is a named signing key. HS256 keys hold a shared secret, EdDSA keys an Ed25519 private key.
+type Key struct {
+	ID        string
+	Algorithm Algorithm
+	secret    []byte
+	private   ed25519.PrivateKey
+	public    ed25519.PublicKey
+}
+
+func NewHS256Key(id string, secret []byte) (*Key, error) {
+	if id == "" || len(secret) < 32 {
+		return nil, fmt.Errorf("%w: HS256 keys need an id and a secret of at least 32 bytes", ErrInvalidKey)
+	}
+
+	return &Key{ID: id, Algorithm: AlgorithmHS256, secret: secret}, nil
+}
+
+func NewEdDSAKey(id string, seed []byte) (*Key, error) {
+	if id == "" || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%w: EdDSA keys need an id and a %d bytes seed", ErrInvalidKey, ed25519.SeedSize)
+	}
+
+	private := ed25519.NewKeyFromSeed(seed)
+
+	return &Key{ID: id, Algorithm: AlgorithmEdDSA, private: private, public: private.Public().(ed25519.PublicKey)}, nil
+}
+
+// ParseKeys reads a comma separated list of "id:algorithm:base64-secret" keys, as accepted by
+// the -token-signing-keys flag. For EdDSA the secret is the 32 bytes Ed25519 seed.
+func ParseKeys(spec string) ([]*Key, error) {
+	var keys []*Key
+
+	for _, part := range strings.Split(spec, ",") {
+		fields := strings.SplitN(strings.TrimSpace(part), ":", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%w: %q is not in id:algorithm:secret form", ErrInvalidKey, part)
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%w: secret of key %q is not valid base64", ErrInvalidKey, fields[0])
+		}
+
+		var key *Key
+		switch Algorithm(fields[1]) {
+		case AlgorithmHS256:
+			key, err = NewHS256Key(fields[0], secret)
+		case AlgorithmEdDSA:
+			key, err = NewEdDSAKey(fields[0], secret)
+		default:
+			err = fmt.Errorf("%w: unknown algorithm %q", ErrInvalidKey, fields[1])
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (k *Key) sign(message []byte) []byte {
+	switch k.Algorithm {
+	case AlgorithmEdDSA:
+		return ed25519.Sign(k.private, message)
+	default:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(message)
+		return mac.Sum(nil)
+	}
+}
+
+func (k *Key) verify(message, signature []byte) bool {
+	switch k.Algorithm {
+	case AlgorithmEdDSA:
+		return ed25519.Verify(k.public, message, signature)
+	default:
+		return hmac.Equal(k.sign(message), signature)
+	}
+}
@@ -0,0 +1,64 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+type window struct {
+	start time.Time
+	hits  int
+}
+
+// Throttle allows at most max hits per key inside a fixed time window. Keys are
+// kept in memory, so limits are per process.
+type Throttle struct {
+	mu      sync.Mutex
+	max     int
+	period  time.Duration
+	windows map[string]*window
+}
+
+// New creates a Throttle allowing max hits per key every period, and starts a background
+// goroutine that forgets keys whose window has expired.
+func New(max int, period time.Duration) *Throttle {
+	t := &Throttle{
+		max:     max,
+		period:  period,
+		windows: make(map[string]*window),
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			t.mu.Lock()
+
+			for key, w := range t.windows {
+				if time.Since(w.start) > t.period {
+					delete(t.windows, key)
+				}
+			}
+
+			t.mu.Unlock()
+		}
+	}()
+
+	return t
+}
+
+// Allow records a hit for key and reports whether it is still inside the limit
+func (t *Throttle) Allow(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, found := t.windows[key]
+	if !found || time.Since(w.start) > t.period {
+		w = &window{start: time.Now()}
+		t.windows[key] = w
+	}
+
+	w.hits++
+
+	return w.hits <= t.max
+}